@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/config"
+	"github.com/nebisin/api_structure/internal/store"
+	"os"
+	osuser "os/user"
+	"strconv"
+	"strings"
+)
+
+// setupCommand parses the common flags of a subcommand and connects to
+// the database. The returned function closes the database connection.
+func setupCommand(name, usage string, args []string) (*flag.FlagSet, *config.Config, store.Models, func(), error) {
+	fs, cfg, db, err := openCommandDB(name, usage, args)
+	if err != nil {
+		return nil, nil, store.Models{}, nil, err
+	}
+
+	timeouts := store.Timeouts{Read: cfg.DB.ReadTimeout, Write: cfg.DB.WriteTimeout}
+
+	return fs, cfg, store.NewModels(db, timeouts, nil), func() { db.Close() }, nil
+}
+
+// openCommandDB parses the common flags of a subcommand, resolves the
+// configuration of the server from its file, the environment and these
+// flags, and opens the database connection pool. Only the database
+// settings have to be valid.
+func openCommandDB(name, usage string, args []string) (*flag.FlagSet, *config.Config, *sql.DB, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "Path of the YAML configuration file")
+	dsn := fs.String("db-dsn", "", "PostgreSQL DSN, overriding the configuration")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return nil, nil, nil, fmt.Errorf("missing %s command", name)
+	}
+
+	var configArgs []string
+	if *file != "" {
+		configArgs = append(configArgs, "-config", *file)
+	}
+	if *dsn != "" {
+		configArgs = append(configArgs, "-db-dsn", *dsn)
+	}
+
+	cfg, err := config.Parse(configArgs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if cfg.DB.DSN == "" {
+		return nil, nil, nil, config.Errors{"db.dsn: must be provided"}
+	}
+
+	var errs config.Errors
+
+	for _, e := range cfg.Validate() {
+		if strings.HasPrefix(e, "db.") {
+			errs = append(errs, e)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, nil, errs
+	}
+
+	db, err := store.OpenDB(cfg.DB.DSN)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return fs, cfg, db, nil
+}
+
+// findUser looks up a user by id when the identifier is numeric
+// and by email otherwise.
+func findUser(models store.Models, identifier string) (*store.User, error) {
+	var (
+		user *store.User
+		err  error
+	)
+
+	if id, parseErr := strconv.ParseInt(identifier, 10, 64); parseErr == nil {
+		user, err = models.Users.Get(context.Background(), id)
+	} else {
+		user, err = models.Users.GetByEmail(context.Background(), strings.ToLower(identifier))
+	}
+
+	if errors.Is(err, store.ErrRecordNotFound) {
+		return nil, fmt.Errorf("user %q not found", identifier)
+	}
+
+	return user, err
+}
+
+// checkPermissions returns an error for the first code
+// which is not a known permission code.
+func checkPermissions(models store.Models, codes []string) error {
+	known, err := models.Permissions.GetAll(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		found := false
+		for _, p := range known {
+			if p.Code == code {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("unknown permission code %q", code)
+		}
+	}
+
+	return nil
+}
+
+// audit records an event of a command through m, which are the models of
+// the transaction of the change when there is one. The commands have no
+// user, so the actor is recorded in the metadata as "cli" with the
+// operating system user running the command.
+func audit(m store.Models, entry store.AuditEntry) error {
+	metadata := map[string]interface{}{"actor": "cli"}
+	if u, err := osuser.Current(); err == nil {
+		metadata["os_user"] = u.Username
+	}
+	for k, v := range entry.Metadata {
+		metadata[k] = v
+	}
+	entry.Metadata = metadata
+
+	event, err := store.NewAuditEvent(entry)
+	if err != nil {
+		return err
+	}
+
+	return m.Audit.Insert(context.Background(), event)
+}
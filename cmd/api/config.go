@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/app"
+	"github.com/nebisin/api_structure/internal/config"
+	"os"
+)
+
+const configUsage = `usage: api config <command> [server flags]
+
+commands:
+  check                       verify the configuration the server would
+                              start with, the database and its schema
+  print                       print the resolved configuration as YAML
+                              with the secrets redacted`
+
+// runConfig is the entry point of the config subcommand.
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return errors.New("missing config command")
+	}
+
+	switch args[0] {
+	case "check":
+		return app.CheckConfig(args[1:], os.Stdout)
+
+	case "print":
+		cfg, err := config.Load(args[1:])
+		if printErr := cfg.Redacted().WriteYAML(os.Stdout); printErr != nil {
+			return printErr
+		}
+		return err
+
+	default:
+		fmt.Fprintln(os.Stderr, configUsage)
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
@@ -1,10 +1,41 @@
 package main
 
 import (
+	"fmt"
 	"github.com/nebisin/api_structure/internal/app"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		var run func([]string) error
+
+		switch os.Args[1] {
+		case "config":
+			run = runConfig
+		case "migrate":
+			run = runMigrate
+		case "permissions":
+			run = runPermissions
+		case "posts":
+			run = runPosts
+		case "roles":
+			run = runRoles
+		case "tokens":
+			run = runTokens
+		case "users":
+			run = runUsers
+		}
+
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	h := app.NewServer()
 
 	h.Run()
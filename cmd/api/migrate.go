@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/migrate"
+	"github.com/nebisin/api_structure/migrations"
+	"strconv"
+)
+
+const migrateUsage = `usage: api migrate [-config file] [-db-dsn dsn] <command> [arguments]
+
+commands:
+  up [N]                      apply all or N pending migrations
+  down <N>|all                revert N or all applied migrations
+  goto <version>              migrate up or down to a version
+  version                     print the current version
+  force <version>             set the version without migrating and clear
+                              the dirty flag, -1 means no migration
+
+The migrations are embedded in the binary. Concurrent runners wait for
+each other through a PostgreSQL advisory lock.`
+
+// runMigrate is the entry point of the migrate subcommand.
+func runMigrate(args []string) error {
+	fs, _, db, err := openCommandDB("migrate", migrateUsage, args)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	migrator.Logf = func(format string, args ...interface{}) {
+		fmt.Printf(format+"\n", args...)
+	}
+
+	ctx := context.Background()
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+
+	switch cmd {
+	case "up":
+		if len(rest) > 1 {
+			return errors.New("usage: api migrate up [N]")
+		}
+
+		if len(rest) == 0 {
+			err = migrator.Up(ctx)
+			break
+		}
+
+		n, parseErr := strconv.Atoi(rest[0])
+		if parseErr != nil || n < 1 {
+			return fmt.Errorf("invalid number of migrations %q", rest[0])
+		}
+
+		err = migrator.Steps(ctx, n)
+
+	case "down":
+		if len(rest) != 1 {
+			return errors.New("usage: api migrate down <N>|all")
+		}
+
+		if rest[0] == "all" {
+			err = migrator.Down(ctx)
+			break
+		}
+
+		n, parseErr := strconv.Atoi(rest[0])
+		if parseErr != nil || n < 1 {
+			return fmt.Errorf("invalid number of migrations %q", rest[0])
+		}
+
+		err = migrator.Steps(ctx, -n)
+
+	case "goto", "force":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: api migrate %s <version>", cmd)
+		}
+
+		version, parseErr := strconv.ParseInt(rest[0], 10, 64)
+		if parseErr != nil {
+			return fmt.Errorf("invalid version %q", rest[0])
+		}
+
+		if cmd == "goto" {
+			err = migrator.Goto(ctx, version)
+		} else {
+			err = migrator.Force(ctx, version)
+		}
+
+	case "version":
+		version, dirty, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+
+		if version == migrate.NilVersion {
+			fmt.Println("no migration applied")
+			return nil
+		}
+
+		if dirty {
+			fmt.Printf("%d (dirty)\n", version)
+			return nil
+		}
+
+		fmt.Println(version)
+		return nil
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", cmd)
+	}
+
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("no change")
+		return nil
+	}
+
+	return err
+}
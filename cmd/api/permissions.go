@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/store"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const permissionsUsage = `usage: api permissions [-config file] [-db-dsn dsn] <command> [arguments]
+
+commands:
+  list                        list every permission code
+  create <code>               create a new permission code
+  show <user>                 list the effective permissions of a user
+  grant <user> <code>...      grant permission codes to a user
+  revoke <user> <code>...     revoke permission codes from a user
+
+<user> is either the id or the email of the user. A code may be a pattern
+such as "posts:*" or "*", and a code prefixed with "!" is a deny entry which
+overrides any matching grant.`
+
+// runPermissions is the entry point of the permissions subcommand.
+func runPermissions(args []string) error {
+	fs, _, models, closeDB, err := setupCommand("permissions", permissionsUsage, args)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+
+	switch cmd {
+	case "list":
+		permissions, err := models.Permissions.GetAll(context.Background())
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tCODE")
+		for _, p := range permissions {
+			fmt.Fprintf(tw, "%d\t%s\n", p.ID, p.Code)
+		}
+		return tw.Flush()
+
+	case "create":
+		if len(rest) != 1 {
+			return errors.New("usage: api permissions create <code>")
+		}
+
+		if !store.ValidPermissionCode(rest[0]) {
+			return fmt.Errorf("invalid permission code %q", rest[0])
+		}
+
+		permission := &store.Permission{Code: rest[0]}
+		err := models.WithTx(context.Background(), func(m store.Models) error {
+			if err := m.Permissions.Insert(context.Background(), permission); err != nil {
+				return err
+			}
+
+			return audit(m, store.AuditEntry{Action: store.AuditPermissionCreate, ResourceType: "permission", ResourceID: permission.ID, After: permission})
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("created permission %q with id %d\n", permission.Code, permission.ID)
+		return nil
+
+	case "show":
+		if len(rest) != 1 {
+			return errors.New("usage: api permissions show <user>")
+		}
+
+		user, err := findUser(models, rest[0])
+		if err != nil {
+			return err
+		}
+
+		return printUserPermissions(models, user)
+
+	case "grant", "revoke":
+		if len(rest) < 2 {
+			return fmt.Errorf("usage: api permissions %s <user> <code>...", cmd)
+		}
+
+		user, err := findUser(models, rest[0])
+		if err != nil {
+			return err
+		}
+
+		codes := rest[1:]
+
+		if cmd == "grant" {
+			if err := checkPermissions(models, codes); err != nil {
+				return err
+			}
+		}
+
+		err = models.WithTx(context.Background(), func(m store.Models) error {
+			action := store.AuditPermissionGrant
+
+			if cmd == "grant" {
+				if err := m.Permissions.AddForUser(context.Background(), user.ID, codes...); err != nil {
+					return err
+				}
+			} else {
+				action = store.AuditPermissionRevoke
+
+				if err := m.Permissions.RemoveForUser(context.Background(), user.ID, codes...); err != nil {
+					return err
+				}
+			}
+
+			return audit(m, store.AuditEntry{Action: action, ResourceType: "user", ResourceID: user.ID, Metadata: map[string]interface{}{"codes": codes}})
+		})
+		if err != nil {
+			return err
+		}
+
+		return printUserPermissions(models, user)
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown permissions command %q", cmd)
+	}
+}
+
+func printUserPermissions(models store.Models, user *store.User) error {
+	permissions, err := models.Permissions.GetAllForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("permissions of %s (id %d): %s\n", user.Email, user.ID, strings.Join(permissions, ", "))
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/store"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const postsUsage = `usage: api posts [-config file] [-db-dsn dsn] <command> [arguments]
+
+commands:
+  list [title]                list every post, private ones included,
+                              optionally matching the title`
+
+// runPosts is the entry point of the posts subcommand.
+func runPosts(args []string) error {
+	fs, _, models, closeDB, err := setupCommand("posts", postsUsage, args)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+
+	switch cmd {
+	case "list":
+		if len(rest) > 1 {
+			return errors.New("usage: api posts list [title]")
+		}
+
+		var title string
+		if len(rest) == 1 {
+			title = rest[0]
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tOWNER\tPRIVATE\tTITLE\tTAGS")
+
+		filters := store.Filters{Page: 1, Limit: 50, Sort: "id"}
+
+		for {
+			posts, err := models.Posts.GetAll(context.Background(), title, nil, store.PostAccess{All: true}, filters)
+			if err != nil {
+				return err
+			}
+
+			for _, post := range posts {
+				fmt.Fprintf(tw, "%d\t%d\t%t\t%s\t%s\n", post.ID, post.UserID, post.Private, post.Title, strings.Join(post.Tags, ", "))
+			}
+
+			if len(posts) < filters.Limit {
+				break
+			}
+
+			filters.Page++
+		}
+
+		return tw.Flush()
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown posts command %q", cmd)
+	}
+}
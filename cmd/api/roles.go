@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/store"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const rolesUsage = `usage: api roles [-config file] [-db-dsn dsn] <command> [arguments]
+
+commands:
+  list                        list every role with its permission codes
+  create <name> [code...]     create a new role with the given permission codes
+  add <name> <code>...        add permission codes to a role
+  remove <name> <code>...     remove permission codes from a role
+  show <user>                 list the roles of a user
+  assign <user> <name>...     assign roles to a user
+  unassign <user> <name>...   unassign roles from a user
+
+<user> is either the id or the email of the user.`
+
+// runRoles is the entry point of the roles subcommand.
+func runRoles(args []string) error {
+	fs, _, models, closeDB, err := setupCommand("roles", rolesUsage, args)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+
+	switch cmd {
+	case "list":
+		roles, err := models.Roles.GetAll(context.Background())
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tPERMISSIONS")
+		for _, role := range roles {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", role.ID, role.Name, strings.Join(role.Permissions, ", "))
+		}
+		return tw.Flush()
+
+	case "create":
+		if len(rest) < 1 {
+			return errors.New("usage: api roles create <name> [code...]")
+		}
+
+		if err := checkPermissions(models, rest[1:]); err != nil {
+			return err
+		}
+
+		role := &store.Role{Name: rest[0]}
+		err := models.WithTx(context.Background(), func(m store.Models) error {
+			if err := m.Roles.Insert(context.Background(), role); err != nil {
+				return err
+			}
+
+			if len(rest) > 1 {
+				if err := m.Roles.AddPermissions(context.Background(), role.ID, rest[1:]...); err != nil {
+					return err
+				}
+			}
+
+			return audit(m, store.AuditEntry{
+				Action:       store.AuditRoleCreate,
+				ResourceType: "role",
+				ResourceID:   role.ID,
+				After:        map[string]interface{}{"name": role.Name, "permissions": rest[1:]},
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		return printRole(models, role.Name)
+
+	case "add", "remove":
+		if len(rest) < 2 {
+			return fmt.Errorf("usage: api roles %s <name> <code>...", cmd)
+		}
+
+		role, err := models.Roles.GetByName(context.Background(), rest[0])
+		if err != nil {
+			if errors.Is(err, store.ErrRecordNotFound) {
+				return fmt.Errorf("role %q not found", rest[0])
+			}
+			return err
+		}
+
+		codes := rest[1:]
+
+		if cmd == "add" {
+			if err := checkPermissions(models, codes); err != nil {
+				return err
+			}
+		}
+
+		err = models.WithTx(context.Background(), func(m store.Models) error {
+			metadata := map[string]interface{}{"added": codes}
+
+			if cmd == "add" {
+				if err := m.Roles.AddPermissions(context.Background(), role.ID, codes...); err != nil {
+					return err
+				}
+			} else {
+				metadata = map[string]interface{}{"removed": codes}
+
+				if err := m.Roles.RemovePermissions(context.Background(), role.ID, codes...); err != nil {
+					return err
+				}
+			}
+
+			return audit(m, store.AuditEntry{Action: store.AuditRoleUpdate, ResourceType: "role", ResourceID: role.ID, Before: role, Metadata: metadata})
+		})
+		if err != nil {
+			return err
+		}
+
+		return printRole(models, role.Name)
+
+	case "show":
+		if len(rest) != 1 {
+			return errors.New("usage: api roles show <user>")
+		}
+
+		user, err := findUser(models, rest[0])
+		if err != nil {
+			return err
+		}
+
+		return printUserRoles(models, user)
+
+	case "assign", "unassign":
+		if len(rest) < 2 {
+			return fmt.Errorf("usage: api roles %s <user> <name>...", cmd)
+		}
+
+		user, err := findUser(models, rest[0])
+		if err != nil {
+			return err
+		}
+
+		names := rest[1:]
+
+		if cmd == "assign" {
+			for _, name := range names {
+				if _, err := models.Roles.GetByName(context.Background(), name); err != nil {
+					if errors.Is(err, store.ErrRecordNotFound) {
+						return fmt.Errorf("role %q not found", name)
+					}
+					return err
+				}
+			}
+		}
+
+		err = models.WithTx(context.Background(), func(m store.Models) error {
+			action := store.AuditRoleAssign
+
+			if cmd == "assign" {
+				if err := m.Roles.AddForUser(context.Background(), user.ID, names...); err != nil {
+					return err
+				}
+			} else {
+				action = store.AuditRoleUnassign
+
+				if err := m.Roles.RemoveForUser(context.Background(), user.ID, names...); err != nil {
+					return err
+				}
+			}
+
+			return audit(m, store.AuditEntry{Action: action, ResourceType: "user", ResourceID: user.ID, Metadata: map[string]interface{}{"roles": names}})
+		})
+		if err != nil {
+			return err
+		}
+
+		return printUserRoles(models, user)
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown roles command %q", cmd)
+	}
+}
+
+func printRole(models store.Models, name string) error {
+	role, err := models.Roles.GetByName(context.Background(), name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("role %s (id %d): %s\n", role.Name, role.ID, strings.Join(role.Permissions, ", "))
+	return nil
+}
+
+func printUserRoles(models store.Models, user *store.User) error {
+	roles, err := models.Roles.GetAllForUser(context.Background(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("roles of %s (id %d): %s\n", user.Email, user.ID, strings.Join(roles, ", "))
+	return printUserPermissions(models, user)
+}
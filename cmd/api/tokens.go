@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/store"
+	"time"
+)
+
+const tokensUsage = `usage: api tokens [-config file] [-db-dsn dsn] <command> [arguments]
+
+commands:
+  issue <user> <scope> [ttl]  issue a token of the activation or
+                              authentication scope, valid for ttl (24h)
+  purge                       delete the expired tokens of every scope
+
+<user> is either the id or the email of the user.`
+
+// runTokens is the entry point of the tokens subcommand.
+func runTokens(args []string) error {
+	fs, _, models, closeDB, err := setupCommand("tokens", tokensUsage, args)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+
+	switch cmd {
+	case "issue":
+		if len(rest) < 2 || len(rest) > 3 {
+			return errors.New("usage: api tokens issue <user> <scope> [ttl]")
+		}
+
+		scope := rest[1]
+		if scope != store.ScopeActivation && scope != store.ScopeAuthentication {
+			return fmt.Errorf("invalid scope %q, must be %s or %s", scope, store.ScopeActivation, store.ScopeAuthentication)
+		}
+
+		ttl := 24 * time.Hour
+		if len(rest) == 3 {
+			ttl, err = time.ParseDuration(rest[2])
+			if err != nil || ttl <= 0 {
+				return fmt.Errorf("invalid ttl %q", rest[2])
+			}
+		}
+
+		user, err := findUser(models, rest[0])
+		if err != nil {
+			return err
+		}
+
+		var token *store.Token
+
+		err = models.WithTx(context.Background(), func(m store.Models) error {
+			token, err = m.Tokens.New(context.Background(), user.ID, ttl, scope)
+			if err != nil {
+				return err
+			}
+
+			return audit(m, store.AuditEntry{
+				Action:       store.AuditTokenCreate,
+				ResourceType: "token",
+				Metadata:     map[string]interface{}{"scope": token.Scope, "user_id": user.ID, "expiry": token.Expiry},
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s token for %s (id %d), expires %s:\n%s\n", scope, user.Email, user.ID, token.Expiry.Format(time.RFC3339), token.Plaintext)
+		return nil
+
+	case "purge":
+		if len(rest) != 0 {
+			return errors.New("usage: api tokens purge")
+		}
+
+		deleted, err := models.Tokens.DeleteExpired(context.Background())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("deleted %d expired tokens\n", deleted)
+		return nil
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown tokens command %q", cmd)
+	}
+}
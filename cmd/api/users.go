@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/store"
+	"os"
+	"strings"
+)
+
+const usersUsage = `usage: api users [-config file] [-db-dsn dsn] <command> [arguments]
+
+commands:
+  create <email> <name> [role...]   create an activated user with the given
+                                    roles, registration.default_role when
+                                    none is given
+  activate <user>                   activate a user and delete its
+                                    activation tokens
+  show <user>                       print a user with its roles and permissions
+
+<user> is either the id or the email of the user. The password of a new
+user is read from the first line of the standard input.`
+
+// runUsers is the entry point of the users subcommand.
+func runUsers(args []string) error {
+	fs, cfg, models, closeDB, err := setupCommand("users", usersUsage, args)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+
+	switch cmd {
+	case "create":
+		if len(rest) < 2 {
+			return errors.New("usage: api users create <email> <name> [role...]")
+		}
+
+		roles := rest[2:]
+		if len(roles) == 0 {
+			roles = []string{cfg.Registration.DefaultRole}
+		}
+
+		for _, name := range roles {
+			if _, err := models.Roles.GetByName(context.Background(), name); err != nil {
+				if errors.Is(err, store.ErrRecordNotFound) {
+					return fmt.Errorf("role %q not found", name)
+				}
+				return err
+			}
+		}
+
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+
+		user := &store.User{
+			Name:      rest[1],
+			Email:     strings.ToLower(rest[0]),
+			Activated: true,
+		}
+
+		if err := user.Password.Set(password); err != nil {
+			return err
+		}
+
+		err = models.WithTx(context.Background(), func(m store.Models) error {
+			if err := m.Users.Insert(context.Background(), user); err != nil {
+				return err
+			}
+
+			if err := m.Roles.AddForUser(context.Background(), user.ID, roles...); err != nil {
+				return err
+			}
+
+			return audit(m, store.AuditEntry{
+				Action:       store.AuditUserCreate,
+				ResourceType: "user",
+				ResourceID:   user.ID,
+				After:        user,
+				Metadata:     map[string]interface{}{"roles": roles},
+			})
+		})
+		if err != nil {
+			if errors.Is(err, store.ErrDuplicateEmail) {
+				return fmt.Errorf("user %q already exists", user.Email)
+			}
+			return err
+		}
+
+		return printUser(models, user)
+
+	case "activate":
+		if len(rest) != 1 {
+			return errors.New("usage: api users activate <user>")
+		}
+
+		user, err := findUser(models, rest[0])
+		if err != nil {
+			return err
+		}
+
+		user.Activated = true
+
+		err = models.WithTx(context.Background(), func(m store.Models) error {
+			if err := m.Users.Update(context.Background(), user); err != nil {
+				return err
+			}
+
+			if err := m.Tokens.DeleteAllForUser(context.Background(), store.ScopeActivation, user.ID); err != nil {
+				return err
+			}
+
+			return audit(m, store.AuditEntry{Action: store.AuditUserActivate, ResourceType: "user", ResourceID: user.ID})
+		})
+		if err != nil {
+			return err
+		}
+
+		return printUser(models, user)
+
+	case "show":
+		if len(rest) != 1 {
+			return errors.New("usage: api users show <user>")
+		}
+
+		user, err := findUser(models, rest[0])
+		if err != nil {
+			return err
+		}
+
+		return printUser(models, user)
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown users command %q", cmd)
+	}
+}
+
+// readPassword reads a password from the first line of the standard input.
+func readPassword() (string, error) {
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "password: ")
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("the password must be given on the standard input")
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if len(password) < 8 || len(password) > 72 {
+		return "", errors.New("the password must be between 8 and 72 bytes long")
+	}
+
+	return password, nil
+}
+
+func printUser(models store.Models, user *store.User) error {
+	fmt.Printf("user %s <%s> (id %d), activated: %t\n", user.Name, user.Email, user.ID, user.Activated)
+	return printUserRoles(models, user)
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"github.com/nebisin/api_structure/pkg/requestid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+const requestInfoContextKey = contextKey("requestInfo")
+
+// requestInfo collects the details of a request which are only known to the
+// inner handlers, such as the authenticated user, for the access log.
+type requestInfo struct {
+	userID int64
+}
+
+// assignRequestID propagates the valid X-Request-ID of the request, or
+// generates one, and sends it back in the response.
+func (s *server) assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		w.Header().Set(requestid.Header, id)
+
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
+
+// logAccess writes one entry per request when the access log is enabled.
+func (s *server) logAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		info := &requestInfo{}
+
+		ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if !s.config().AccessLog {
+			return
+		}
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		fields := logrus.Fields{
+			"request_method": r.Method,
+			"request_url":    r.URL.String(),
+			"status":         rec.status,
+			"bytes":          rec.size,
+			"duration_ms":    float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":      s.realIP.ClientIP(r),
+		}
+		if info.userID != 0 {
+			fields["user_id"] = info.userID
+		}
+
+		s.logger.WithContext(ctx).WithFields(fields).Info("request")
+	})
+}
+
+// setLogFormat switches the format of the logs, text or json.
+func (s *server) setLogFormat(format string) {
+	switch format {
+	case "json":
+		s.logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		s.logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+}
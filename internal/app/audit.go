@@ -0,0 +1,41 @@
+package app
+
+import (
+	"context"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/realip"
+	"github.com/nebisin/api_structure/pkg/requestid"
+	"net/http"
+)
+
+// audit records an event in the audit log with the user, the impersonator,
+// the IP and the request ID of the request. The actor defaults to the
+// user of the request. Failures are logged but never fail the request.
+func (s *server) audit(r *http.Request, entry store.AuditEntry) {
+	user, _ := r.Context().Value(userContextKey).(*store.User)
+	if user != nil && !user.IsAnonymous() && entry.ActorID == 0 {
+		entry.ActorID = user.ID
+	}
+
+	event, err := store.NewAuditEvent(entry)
+	if err == nil {
+		event.IP = realip.FromContext(r.Context())
+		event.RequestID = requestid.FromContext(r.Context())
+
+		if user != nil && user.Impersonator != nil {
+			event.ImpersonatorID = user.Impersonator.ID
+		}
+
+		// The event is recorded even when the client has gone away
+		// in the meantime, so the request context is not used here.
+		err = s.models.Audit.Insert(context.Background(), event)
+	}
+
+	if err != nil {
+		s.logger.WithContext(r.Context()).WithFields(map[string]interface{}{
+			"request_method": r.Method,
+			"request_url":    r.URL.String(),
+			"audit_action":   entry.Action,
+		}).WithError(err).Error("audit error")
+	}
+}
@@ -1,20 +1,24 @@
 package app
 
-import "fmt"
+import (
+	"fmt"
+)
 
-// Gracefully shutdown for background tasks
-func (s *server) background(fn func()) {
-	s.wg.Add(1)
+// background runs fn in a goroutine counted by the background_tasks gauge
+// until it returns, such as an outbox worker or a periodic cleanup. A panic
+// of fn is logged with the name of the task.
+func (s *server) background(name string, fn func()) {
+	s.metrics.backgroundTasks.Inc()
 
 	go func() {
-		defer s.wg.Done()
+		defer s.metrics.backgroundTasks.Dec()
 
 		defer func() {
 			if err := recover(); err != nil {
-				s.logger.WithError(fmt.Errorf("%s", err)).Error("background email error")
+				s.logger.WithField("task", name).WithError(fmt.Errorf("%s", err)).Error("background task error")
 			}
 		}()
 
 		fn()
 	}()
-}
\ No newline at end of file
+}
@@ -3,55 +3,54 @@ package app
 import (
 	"context"
 	"database/sql"
-	"flag"
+	"errors"
+	"expvar"
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/nebisin/api_structure/internal/config"
 	"github.com/nebisin/api_structure/internal/mailer"
+	"github.com/nebisin/api_structure/internal/migrate"
+	"github.com/nebisin/api_structure/internal/ratelimit"
 	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/migrations"
+	"github.com/nebisin/api_structure/pkg/realip"
+	"github.com/nebisin/api_structure/pkg/requestid"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/time/rate"
+	"net/http"
 	"os"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const version = "1.0.0"
 
-type config struct {
-	port string
-	env  string
-	dsn  string
-	smtp struct {
-		host     string
-		port     int
-		username string
-		password string
-		sender   string
-	}
-	cors struct{
-		trustedOrigins []string
-	}
-}
-
 type server struct {
-	db      *sql.DB
-	router  *mux.Router
+	db     *sql.DB
+	router *mux.Router
+	// handler serves the health checks, which are not filtered, limited
+	// nor authenticated, and passes the other requests to router.
+	handler http.Handler
 	logger  *logrus.Logger
-	config  config
-	limiter struct {
-		mu      sync.Mutex
-		clients map[string]*client
-	}
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
-	models store.Models
-}
-
-type client struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
+	// configValue holds the current *config.Config, which is replaced
+	// as a whole when the configuration is reloaded.
+	configValue atomic.Value
+	limiter     ratelimit.Limiter
+	realIP      *realip.Resolver
+	metrics     *metrics
+	// ipFilter holds the current *ipFilter.
+	ipFilter atomic.Value
+	// reloadMu serializes the reloads of the configuration and the
+	// refreshes of the IP filter, which is built from it.
+	reloadMu sync.Mutex
+	mailer   mailer.Mailer
+	migrator *migrate.Migrator
+	// outboxWake wakes up an idle outbox worker.
+	outboxWake chan struct{}
+	// draining is set to 1 once the server is shutting down.
+	draining        int32
+	models          store.Models
+	permissionCache *store.PermissionCache
 }
 
 func NewServer() *server {
@@ -61,93 +60,175 @@ func NewServer() *server {
 func (s *server) Run() {
 	s.logger = logrus.New()
 	s.logger.SetOutput(os.Stdout)
-	s.logger.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
+	s.logger.AddHook(requestid.LogHook{})
+	s.setLogFormat("text")
 
 	s.getConfig()
+	s.setupRealIP()
+	s.metrics = newMetrics()
+
+	shutdownTracing := s.setupTracing()
+	defer shutdownTracing()
 	s.routes()
-	s.setupLimiter()
 
-	s.mailer = mailer.New(s.config.smtp.host, s.config.smtp.port, s.config.smtp.username, s.config.smtp.password, s.config.smtp.sender)
+	s.setupMailer()
 
-	s.logger.Info("connecting the database")
-	db, err := openDB(s.config)
-	if err != nil {
-		s.logger.WithError(err).Fatal("an error occurred while connecting the database")
+	s.setupPermissionCache()
+
+	switch s.config().Store {
+	case "memory":
+		s.logger.Warn("using the in-memory store, data will be lost on shutdown")
+		s.models = store.NewMemoryModels(s.permissionCache)
+	case "postgres":
+		s.logger.Info("connecting the database")
+		db, err := store.OpenDB(s.config().DB.DSN)
+		if err != nil {
+			s.logger.WithError(err).Fatal("an error occurred while connecting the database")
+		}
+		defer db.Close()
+		s.db = db
+
+		s.metrics.registry.MustRegister(collectors.NewDBStatsCollector(db, "api"))
+
+		migrator, err := migrate.New(db, migrations.FS)
+		if err != nil {
+			s.logger.WithError(err).Fatal("an error occurred while loading the migrations")
+		}
+		migrator.Logf = s.logger.Infof
+		s.migrator = migrator
+
+		if s.config().DB.AutoMigrate {
+			s.migrate()
+		}
+
+		s.models = store.NewModels(db, s.dbTimeouts(), s.permissionCache)
+	default:
+		s.logger.WithField("store", s.config().Store).Fatal("unknown storage backend")
 	}
-	defer db.Close()
-	s.db = db
 
-	s.models = store.NewModels(db)
+	s.setupLimiter()
+	s.setupIPFilter()
+	s.watchConfig()
+
+	if _, err := s.models.Roles.GetByName(context.Background(), s.config().Registration.DefaultRole); err != nil {
+		s.logger.WithError(err).WithField("role", s.config().Registration.DefaultRole).Fatal("an error occurred while checking the default registration role")
+	}
+
+	s.outboxWake = make(chan struct{}, 1)
+	stopOutbox := s.startOutbox()
 
 	if err := s.serve(); err != nil {
 		s.logger.WithError(err).Fatal("an error occurred while starting the server")
 	}
+
+	s.logger.Info("stopping the outbox workers")
+	stopOutbox()
 }
 
 func (s *server) getConfig() {
-	var cfg config
-
-	s.logger.Info("we are getting env values")
-	err := godotenv.Load()
+	s.logger.Info("we are loading the configuration")
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		s.logger.WithError(err).Fatal("something went wrong while getting env")
+		s.logger.WithError(err).Fatal("something went wrong while loading the configuration")
 	}
 
-	flag.StringVar(&cfg.port, "port", os.Getenv("PORT"), "API server port")
-	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	s.setConfig(cfg)
+}
 
-	flag.StringVar(&cfg.dsn, "db-dsn", os.Getenv("DB_URI"), "PostgreSQL DSN")
+// config returns the current configuration. It must be called again rather
+// than kept around so that reloaded settings take effect.
+func (s *server) config() *config.Config {
+	return s.configValue.Load().(*config.Config)
+}
 
-	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SMTP_HOST"), "SMTP host")
-	flag.IntVar(&cfg.smtp.port, "smtp-port", 2525, "SMTP port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SMTP_USERNAME"), "SMTP username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
-	flag.StringVar(&cfg.smtp.sender, "smtp-sender", os.Getenv("SMTP_SENDER"), "SMTP sender")
+func (s *server) dbTimeouts() store.Timeouts {
+	return store.Timeouts{Read: s.config().DB.ReadTimeout, Write: s.config().DB.WriteTimeout}
+}
 
-	flag.Func("cors-trusted-origins", "Trusted CORS origins (space seperated)", func(val string) error {
-		cfg.cors.trustedOrigins = strings.Fields(val)
-		return nil
-	})
+// migrate applies the pending embedded migrations.
+func (s *server) migrate() {
+	s.logger.Info("applying the database migrations")
+	if err := s.migrator.Up(context.Background()); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		s.logger.WithError(err).Fatal("an error occurred while migrating the database")
+	}
+}
 
-	flag.Parse()
+// setupMailer creates the mailer with the configured backend.
+func (s *server) setupMailer() {
+	cfg := s.config()
 
-	s.config = cfg
-}
+	var sender mailer.Sender
 
-func openDB(cfg config) (*sql.DB, error) {
-	db, err := sql.Open("postgres", cfg.dsn)
-	if err != nil {
-		return nil, err
+	switch cfg.Mailer.Backend {
+	case "smtp":
+		sender = mailer.NewSMTP(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password)
+	case "file":
+		fileSender, err := mailer.NewFile(cfg.Mailer.Dir)
+		if err != nil {
+			s.logger.WithError(err).Fatal("an error occurred while creating the maildir")
+		}
+		sender = fileSender
+	case "log":
+		sender = mailer.NewLog(s.logger)
+	case "memory":
+		sender = mailer.NewMemory()
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-
-	if err := db.PingContext(ctx); err != nil {
-		return nil, err
+	if cfg.Mailer.Backend != "smtp" {
+		s.logger.WithField("backend", cfg.Mailer.Backend).Warn("emails are not delivered by the mailer backend")
 	}
 
-	return db, nil
+	s.mailer = mailer.New(sender, cfg.SMTP.Sender)
 }
 
+// setupLimiter creates the rate limiter of the configured backend.
 func (s *server) setupLimiter() {
-	s.limiter.clients = make(map[string]*client)
+	switch s.config().Limiter.Backend {
+	case "postgres":
+		s.limiter = ratelimit.NewPostgres(s.db, s.config().DB.WriteTimeout)
+	default:
+		s.limiter = ratelimit.NewMemory()
+	}
 
-	go func() {
+	s.background("rate limit cleanup", func() {
 		for {
 			time.Sleep(time.Minute)
 
-			s.limiter.mu.Lock()
-
-			for ip, client := range s.limiter.clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(s.limiter.clients, ip)
-				}
+			if err := s.limiter.DeleteExpired(context.Background()); err != nil {
+				s.logger.WithError(err).Error("an error occurred while deleting the expired rate limits")
 			}
+		}
+	})
+}
 
-			s.limiter.mu.Unlock()
+// setupRealIP creates the resolver of the client IP addresses.
+func (s *server) setupRealIP() {
+	resolver, err := realip.NewResolver(s.config().Proxies.Trusted)
+	if err != nil {
+		s.logger.WithError(err).Fatal("an error occurred while parsing the trusted proxies")
+	}
+
+	s.realIP = resolver
+}
+
+// setupPermissionCache creates the permission cache when it is enabled
+// and publishes its counters under the "permission_cache" expvar.
+func (s *server) setupPermissionCache() {
+	if s.config().Permissions.CacheTTL <= 0 {
+		return
+	}
+
+	s.permissionCache = store.NewPermissionCache(s.config().Permissions.CacheTTL)
+
+	expvar.Publish("permission_cache", expvar.Func(func() interface{} {
+		return s.permissionCache.Stats()
+	}))
+
+	s.background("permission cache cleanup", func() {
+		for {
+			time.Sleep(time.Minute)
+
+			s.permissionCache.DeleteExpired()
 		}
-	}()
+	})
 }
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/config"
+	"github.com/nebisin/api_structure/internal/migrate"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/migrations"
+	"io"
+)
+
+// CheckConfig loads the configuration from args like the server does and
+// verifies it, including the database connection, the schema version and
+// the default registration role. Every problem is reported to w and an
+// error is returned when any check failed.
+func CheckConfig(args []string, w io.Writer) error {
+	failed := false
+
+	report := func(name string, err error) {
+		if err != nil {
+			failed = true
+			fmt.Fprintf(w, "FAIL  %s: %v\n", name, err)
+			return
+		}
+
+		fmt.Fprintf(w, "ok    %s\n", name)
+	}
+
+	cfg, err := config.Load(args)
+
+	var errs config.Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			fmt.Fprintf(w, "FAIL  %s\n", e)
+		}
+		failed = true
+	} else {
+		report("configuration", err)
+	}
+
+	var models store.Models
+
+	switch cfg.Store {
+	case "memory":
+		models = store.NewMemoryModels(nil)
+	case "postgres":
+		if cfg.DB.DSN == "" {
+			break
+		}
+
+		db, err := store.OpenDB(cfg.DB.DSN)
+		report("database connection", err)
+		if err != nil {
+			break
+		}
+		defer db.Close()
+
+		report("database schema", checkSchema(db))
+
+		models = store.NewModels(db, store.Timeouts{Read: cfg.DB.ReadTimeout, Write: cfg.DB.WriteTimeout}, nil)
+	}
+
+	if models.Roles != nil {
+		_, err := models.Roles.GetByName(context.Background(), cfg.Registration.DefaultRole)
+		if errors.Is(err, store.ErrRecordNotFound) {
+			err = fmt.Errorf("role %q does not exist", cfg.Registration.DefaultRole)
+		}
+		report("registration default role", err)
+	}
+
+	if failed {
+		return errors.New("configuration check failed")
+	}
+
+	return nil
+}
+
+// checkSchema verifies that every embedded migration is applied.
+func checkSchema(db *sql.DB) error {
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := migrator.Version(context.Background())
+	switch {
+	case err != nil:
+		return err
+	case dirty:
+		return fmt.Errorf("version %d is dirty", version)
+	case version != migrator.Latest():
+		return fmt.Errorf("version %d, the latest migration is %d", version, migrator.Latest())
+	}
+
+	return nil
+}
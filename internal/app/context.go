@@ -11,6 +11,10 @@ type contextKey string
 const userContextKey = contextKey("user")
 
 func (s *server) contextSetUser(r *http.Request, user *store.User) *http.Request {
+	if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok && !user.IsAnonymous() {
+		info.userID = user.ID
+	}
+
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/request"
+	"github.com/nebisin/api_structure/pkg/response"
+	"net/http"
+	"strconv"
+)
+
+func (s *server) handleListACLEntries(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ResourceType string `validate:"oneof='post'"`
+		ResourceID   *int64
+	}
+
+	qs := r.URL.Query()
+
+	input.ResourceType = request.ReadString(qs, "resource_type", store.ResourcePost)
+
+	if qs.Get("resource_id") != "" {
+		id := int64(request.ReadInt(qs, "resource_id", 0))
+		input.ResourceID = &id
+	}
+
+	if err := request.ValidateInput(&input); err != nil {
+		response.FailedValidationResponse(w, err)
+		return
+	}
+
+	entries, err := s.models.ACL.GetAllForResource(r.Context(), input.ResourceType, input.ResourceID)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"acl": entries}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func (s *server) handleCreateACLEntry(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ResourceType string `json:"resource_type" validate:"required,oneof='post'"`
+		ResourceID   *int64 `json:"resource_id"`
+		SubjectType  string `json:"subject_type" validate:"required,oneof='user' 'role'"`
+		SubjectID    int64  `json:"subject_id" validate:"required,gt=0"`
+		Action       string `json:"action" validate:"required,oneof='read' 'write'"`
+	}
+
+	if err := request.ReadJSON(w, r, &input); err != nil {
+		response.BadRequestResponse(w, err)
+		return
+	}
+
+	if err := request.ValidateInput(&input); err != nil {
+		response.FailedValidationResponse(w, err)
+		return
+	}
+
+	if input.ResourceID != nil {
+		if _, err := s.models.Posts.Get(r.Context(), *input.ResourceID); err != nil {
+			switch {
+			case errors.Is(err, store.ErrRecordNotFound):
+				response.FailedValidationResponse(w, map[string]string{"resource_id": "must refer to an existing resource"})
+			default:
+				response.ServerErrorResponse(w, r, s.logger, err)
+			}
+			return
+		}
+	}
+
+	exists, err := s.subjectExists(r.Context(), input.SubjectType, input.SubjectID)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if !exists {
+		response.FailedValidationResponse(w, map[string]string{"subject_id": "must refer to an existing subject"})
+		return
+	}
+
+	entry := &store.ACLEntry{
+		ResourceType: input.ResourceType,
+		ResourceID:   input.ResourceID,
+		SubjectType:  input.SubjectType,
+		SubjectID:    input.SubjectID,
+		Action:       input.Action,
+	}
+
+	if err := s.models.ACL.Insert(r.Context(), entry); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateACLEntry):
+			response.FailedValidationResponse(w, map[string]string{"acl_entry": "is already exist"})
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	s.audit(r, store.AuditEntry{Action: store.AuditACLCreate, ResourceType: "acl_entry", ResourceID: entry.ID, After: entry})
+
+	if err := response.JSONResponse(w, http.StatusCreated, response.Envelope{"acl_entry": entry}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func (s *server) handleDeleteACLEntry(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	if err := s.models.ACL.Delete(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	s.audit(r, store.AuditEntry{Action: store.AuditACLDelete, ResourceType: "acl_entry", ResourceID: id})
+
+	err = response.JSONResponse(w, http.StatusOK, response.Envelope{"message": "acl entry successfully deleted"})
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+// subjectExists reports whether the user or role an ACL entry refers to exists.
+func (s *server) subjectExists(ctx context.Context, subjectType string, subjectID int64) (bool, error) {
+	switch subjectType {
+	case store.SubjectUser:
+		_, err := s.models.Users.Get(ctx, subjectID)
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+
+	case store.SubjectRole:
+		roles, err := s.models.Roles.GetAll(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		for i := range roles {
+			if roles[i].ID == subjectID {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/request"
+	"github.com/nebisin/api_structure/pkg/response"
+	"net/http"
+	"time"
+)
+
+func (s *server) handleListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	var filter store.AuditFilter
+
+	qs := r.URL.Query()
+
+	filter.Action = request.ReadString(qs, "action", "")
+	filter.ActorID = int64(request.ReadInt(qs, "actor_id", 0))
+	filter.ResourceType = request.ReadString(qs, "resource_type", "")
+	filter.ResourceID = request.ReadString(qs, "resource_id", "")
+	filter.Since = request.ReadTime(qs, "since", time.Time{})
+	filter.Until = request.ReadTime(qs, "until", time.Time{})
+	filter.Cursor = int64(request.ReadInt(qs, "cursor", 0))
+	filter.Limit = request.ReadInt(qs, "limit", 20)
+
+	if errs := request.ValidateInput(filter); errs != nil {
+		response.FailedValidationResponse(w, errs)
+		return
+	}
+
+	events, next, err := s.models.Audit.GetAll(r.Context(), filter)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	err = response.JSONResponse(w, http.StatusOK, response.Envelope{
+		"audit_events": events,
+		"metadata":     map[string]interface{}{"next_cursor": next},
+	})
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/request"
+	"github.com/nebisin/api_structure/pkg/response"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func (s *server) handleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string   `json:"email" validate:"required,email"`
+		Roles []string `json:"roles" validate:"unique"`
+	}
+
+	if err := request.ReadJSON(w, r, &input); err != nil {
+		response.BadRequestResponse(w, err)
+		return
+	}
+
+	if err := request.ValidateInput(&input); err != nil {
+		response.FailedValidationResponse(w, err)
+		return
+	}
+
+	// Assigning roles through an invitation requires the permission of
+	// assigning them directly, or invitations:write would grant any role.
+	if len(input.Roles) > 0 {
+		allowed, err := s.hasPermission(r.Context(), s.contextGetUser(r), "permissions:write")
+		if err != nil {
+			response.ServerErrorResponse(w, r, s.logger, err)
+			return
+		}
+
+		if !allowed {
+			response.NotPermittedResponse(w, r)
+			return
+		}
+
+		known, err := s.models.Roles.GetAll(r.Context())
+		if err != nil {
+			response.ServerErrorResponse(w, r, s.logger, err)
+			return
+		}
+
+		for _, name := range input.Roles {
+			if !containsRole(known, name) {
+				response.FailedValidationResponse(w, map[string]string{"roles": "must contain only existing roles"})
+				return
+			}
+		}
+	}
+
+	email := strings.ToLower(input.Email)
+
+	if _, err := s.models.Users.GetByEmail(r.Context(), email); err == nil {
+		response.FailedValidationResponse(w, map[string]string{"email": "is already exist"})
+		return
+	} else if !errors.Is(err, store.ErrRecordNotFound) {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	var invitation *store.Invitation
+
+	err := s.models.WithTx(r.Context(), func(m store.Models) error {
+		var err error
+
+		invitation, err = m.Invitations.New(r.Context(), email, input.Roles, s.contextGetUser(r).ID, s.config().Tokens.InvitationTTL)
+		if err != nil {
+			return err
+		}
+
+		data := map[string]interface{}{
+			"invitationToken": invitation.Plaintext,
+			"email":           invitation.Email,
+		}
+
+		return s.enqueueMail(r.Context(), m, invitation.Email, "user_invitation.tmpl", data)
+	})
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.audit(r, store.AuditEntry{Action: store.AuditInvitationCreate, ResourceType: "invitation", ResourceID: invitation.ID, After: invitation})
+
+	s.wakeOutbox()
+
+	err = response.JSONResponse(w, http.StatusAccepted, response.Envelope{"invitation": invitation})
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func (s *server) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := s.models.Invitations.GetAll(r.Context())
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"invitations": invitations}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func (s *server) handleDeleteInvitation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	if err := s.models.Invitations.Delete(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	s.audit(r, store.AuditEntry{Action: store.AuditInvitationDelete, ResourceType: "invitation", ResourceID: id})
+
+	err = response.JSONResponse(w, http.StatusOK, response.Envelope{"message": "invitation successfully deleted"})
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/realip"
+	"github.com/nebisin/api_structure/pkg/request"
+	"github.com/nebisin/api_structure/pkg/response"
+	"net/http"
+	"strconv"
+)
+
+func (s *server) handleListIPRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.models.IPRules.GetAll(r.Context())
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"ip_rules": rules}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func (s *server) handleCreateIPRule(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		PathPrefix string `json:"path_prefix" validate:"required,startswith=/"`
+		Action     string `json:"action" validate:"required,oneof='allow' 'deny'"`
+		CIDR       string `json:"cidr" validate:"required,cidr|ip"`
+		Comment    string `json:"comment" validate:"max=500"`
+	}
+
+	if err := request.ReadJSON(w, r, &input); err != nil {
+		response.BadRequestResponse(w, err)
+		return
+	}
+
+	if err := request.ValidateInput(&input); err != nil {
+		response.FailedValidationResponse(w, err)
+		return
+	}
+
+	network, err := realip.ParseNetwork(input.CIDR)
+	if err != nil {
+		response.FailedValidationResponse(w, map[string]string{"cidr": "must be a valid CIDR or IP address"})
+		return
+	}
+
+	rule := &store.IPRule{
+		PathPrefix: input.PathPrefix,
+		Action:     input.Action,
+		CIDR:       network.String(),
+		Comment:    input.Comment,
+	}
+
+	if err := s.models.IPRules.Insert(r.Context(), rule); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateIPRule):
+			response.FailedValidationResponse(w, map[string]string{"ip_rule": "is already exist"})
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	if err := s.refreshIPFilter(r.Context()); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.audit(r, store.AuditEntry{Action: store.AuditIPRuleCreate, ResourceType: "ip_rule", ResourceID: rule.ID, After: rule})
+
+	if err := response.JSONResponse(w, http.StatusCreated, response.Envelope{"ip_rule": rule}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func (s *server) handleDeleteIPRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	if err := s.models.IPRules.Delete(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	if err := s.refreshIPFilter(r.Context()); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.audit(r, store.AuditEntry{Action: store.AuditIPRuleDelete, ResourceType: "ip_rule", ResourceID: id})
+
+	err = response.JSONResponse(w, http.StatusOK, response.Envelope{"message": "ip rule successfully deleted"})
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nebisin/api_structure/internal/store"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestHandleCreateIPRule(t *testing.T) {
+	s := newTestServer(t, nil)
+	_, token := newTestUser(t, s, "admin", "ip_rules:write")
+
+	const body = `{"path_prefix": "/api/v1/posts", "action": "deny", "cidr": "198.51.100.7/24"}`
+
+	w := serveTestRequest(s, http.MethodPost, "/api/v1/ip-rules", token, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("first POST = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+
+	var created struct {
+		IPRule store.IPRule `json:"ip_rule"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	if created.IPRule.ID == 0 || created.IPRule.CIDR != "198.51.100.0/24" {
+		t.Errorf("created rule = %+v, want an id and the network 198.51.100.0/24", created.IPRule)
+	}
+
+	w = serveTestRequest(s, http.MethodPost, "/api/v1/ip-rules", token, body)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("duplicate POST = %d, want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body)
+	}
+
+	events, _, err := s.models.Audit.GetAll(context.Background(), store.AuditFilter{Action: store.AuditIPRuleCreate, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id := strconv.FormatInt(created.IPRule.ID, 10); len(events) != 1 || events[0].ResourceID != id {
+		t.Errorf("audit events = %+v, want one for the rule %s", events, id)
+	}
+}
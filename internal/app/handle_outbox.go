@@ -0,0 +1,102 @@
+package app
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/request"
+	"github.com/nebisin/api_structure/pkg/response"
+	"net/http"
+	"strconv"
+)
+
+func (s *server) handleListOutbox(w http.ResponseWriter, r *http.Request) {
+	var filter store.OutboxFilter
+
+	qs := r.URL.Query()
+
+	filter.Status = request.ReadString(qs, "status", "")
+	filter.Cursor = int64(request.ReadInt(qs, "cursor", 0))
+	filter.Limit = request.ReadInt(qs, "limit", 20)
+
+	if errs := request.ValidateInput(filter); errs != nil {
+		response.FailedValidationResponse(w, errs)
+		return
+	}
+
+	messages, next, err := s.models.Outbox.GetAll(r.Context(), filter)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	err = response.JSONResponse(w, http.StatusOK, response.Envelope{
+		"outbox":   messages,
+		"metadata": map[string]interface{}{"next_cursor": next},
+	})
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func (s *server) handleShowOutboxMessage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	msg, err := s.models.Outbox.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"message": msg}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+// handleRedriveOutboxMessage makes a dead-lettered email pending again,
+// with all its attempts available.
+func (s *server) handleRedriveOutboxMessage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	msg, err := s.models.Outbox.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	if err := s.models.Outbox.Redrive(r.Context(), msg); err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			response.FailedValidationResponse(w, map[string]string{"status": "must be dead to be redriven"})
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	s.wakeOutbox()
+
+	s.audit(r, store.AuditEntry{Action: store.AuditOutboxRedrive, ResourceType: "outbox_message", ResourceID: msg.ID, After: msg})
+
+	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"message": msg}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
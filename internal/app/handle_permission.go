@@ -0,0 +1,204 @@
+package app
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/request"
+	"github.com/nebisin/api_structure/pkg/response"
+	"net/http"
+	"strconv"
+)
+
+func (s *server) handleListPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := s.models.Permissions.GetAll(r.Context())
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"permissions": permissions}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func (s *server) handleCreatePermission(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code" validate:"required,max=100"`
+	}
+
+	if err := request.ReadJSON(w, r, &input); err != nil {
+		response.BadRequestResponse(w, err)
+		return
+	}
+
+	if err := request.ValidateInput(&input); err != nil {
+		response.FailedValidationResponse(w, err)
+		return
+	}
+
+	if !store.ValidPermissionCode(input.Code) {
+		response.FailedValidationResponse(w, map[string]string{"code": "must be a valid permission code, pattern or deny entry"})
+		return
+	}
+
+	permission := &store.Permission{Code: input.Code}
+
+	if err := s.models.Permissions.Insert(r.Context(), permission); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicatePermission):
+			response.FailedValidationResponse(w, map[string]string{"code": "is already exist"})
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	s.audit(r, store.AuditEntry{Action: store.AuditPermissionCreate, ResourceType: "permission", ResourceID: permission.ID, After: permission})
+
+	if err := response.JSONResponse(w, http.StatusCreated, response.Envelope{"permission": permission}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func (s *server) handleShowUserPermissions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	user, err := s.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	s.writeUserPermissions(w, r, user.ID)
+}
+
+func (s *server) handleGrantUserPermissions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Codes []string `json:"codes" validate:"required,min=1,unique"`
+	}
+
+	if err := request.ReadJSON(w, r, &input); err != nil {
+		response.BadRequestResponse(w, err)
+		return
+	}
+
+	if err := request.ValidateInput(&input); err != nil {
+		response.FailedValidationResponse(w, err)
+		return
+	}
+
+	user, err := s.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	ok, err := s.permissionsExist(r.Context(), input.Codes)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if !ok {
+		response.FailedValidationResponse(w, map[string]string{"codes": "must contain only existing permission codes"})
+		return
+	}
+
+	if err := s.models.Permissions.AddForUser(r.Context(), user.ID, input.Codes...); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditPermissionGrant,
+		ResourceType: "user",
+		ResourceID:   user.ID,
+		Metadata:     map[string]interface{}{"codes": input.Codes},
+	})
+
+	s.writeUserPermissions(w, r, user.ID)
+}
+
+func (s *server) handleRevokeUserPermission(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	user, err := s.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	if err := s.models.Permissions.RemoveForUser(r.Context(), user.ID, vars["code"]); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditPermissionRevoke,
+		ResourceType: "user",
+		ResourceID:   user.ID,
+		Metadata:     map[string]interface{}{"codes": []string{vars["code"]}},
+	})
+
+	s.writeUserPermissions(w, r, user.ID)
+}
+
+// writeUserPermissions sends the current permission codes of a user.
+func (s *server) writeUserPermissions(w http.ResponseWriter, r *http.Request, userID int64) {
+	permissions, err := s.models.Permissions.GetAllForUser(r.Context(), userID)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if permissions == nil {
+		permissions = store.Permissions{}
+	}
+
+	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"permissions": permissions}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func containsPermission(permissions []*store.Permission, code string) bool {
+	for i := range permissions {
+		if permissions[i].Code == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -12,9 +12,10 @@ import (
 
 func (s *server) handleCreatePost(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title string   `json:"title" validate:"required"`
-		Body  string   `json:"body" validate:"required"`
-		Tags  []string `json:"tags,omitempty" validate:"unique"`
+		Title   string   `json:"title" validate:"required"`
+		Body    string   `json:"body" validate:"required"`
+		Tags    []string `json:"tags,omitempty" validate:"unique"`
+		Private bool     `json:"private"`
 	}
 
 	if err := request.ReadJSON(w, r, &input); err != nil {
@@ -28,17 +29,21 @@ func (s *server) handleCreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	post := store.Post{
-		Title: input.Title,
-		Body:  input.Body,
-		Tags:  input.Tags,
+		UserID:  s.contextGetUser(r).ID,
+		Title:   input.Title,
+		Body:    input.Body,
+		Tags:    input.Tags,
+		Private: input.Private,
 	}
 
-	err := s.models.Posts.Insert(&post)
+	err := s.models.Posts.Insert(r.Context(), &post)
 	if err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
 		return
 	}
 
+	s.audit(r, store.AuditEntry{Action: store.AuditPostCreate, ResourceType: store.ResourcePost, ResourceID: post.ID, After: post})
+
 	if err := response.JSONResponse(w, http.StatusCreated, response.Envelope{"post": post}); err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
 	}
@@ -52,7 +57,7 @@ func (s *server) handleShowPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := s.models.Posts.Get(id)
+	post, err := s.models.Posts.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrRecordNotFound):
@@ -63,6 +68,17 @@ func (s *server) handleShowPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	allowed, err := s.canAccessPost(r, post, store.ActionRead)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if !allowed {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
 	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"post": post}); err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
 	}
@@ -76,7 +92,7 @@ func (s *server) handleUpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := s.models.Posts.Get(id)
+	post, err := s.models.Posts.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrRecordNotFound):
@@ -87,6 +103,12 @@ func (s *server) handleUpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizePostWrite(w, r, post) {
+		return
+	}
+
+	before := *post
+
 	if r.Header.Get("X-Expected-Version") != "" {
 		if strconv.FormatInt(int64(post.Version), 32) != r.Header.Get("X-Expected-Version") {
 			response.EditConflictResponse(w)
@@ -95,9 +117,10 @@ func (s *server) handleUpdatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input struct {
-		Title *string  `json:"title"`
-		Body  *string  `json:"body"`
-		Tags  []string `json:"tags,omitempty" validate:"unique"`
+		Title   *string  `json:"title"`
+		Body    *string  `json:"body"`
+		Tags    []string `json:"tags,omitempty" validate:"unique"`
+		Private *bool    `json:"private"`
 	}
 
 	if err = request.ReadJSON(w, r, &input); err != nil {
@@ -120,7 +143,11 @@ func (s *server) handleUpdatePost(w http.ResponseWriter, r *http.Request) {
 		post.Tags = input.Tags
 	}
 
-	if err := s.models.Posts.Update(post); err != nil {
+	if input.Private != nil {
+		post.Private = *input.Private
+	}
+
+	if err := s.models.Posts.Update(r.Context(), post); err != nil {
 		switch {
 		case errors.Is(err, store.ErrEditConflict):
 			response.EditConflictResponse(w)
@@ -130,6 +157,8 @@ func (s *server) handleUpdatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.audit(r, store.AuditEntry{Action: store.AuditPostUpdate, ResourceType: store.ResourcePost, ResourceID: post.ID, Before: before, After: post})
+
 	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"post": post}); err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
 	}
@@ -143,7 +172,8 @@ func (s *server) handleDeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.models.Posts.Delete(id); err != nil {
+	post, err := s.models.Posts.Get(r.Context(), id)
+	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrRecordNotFound):
 			response.NotFoundResponse(w, r)
@@ -153,6 +183,22 @@ func (s *server) handleDeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizePostWrite(w, r, post) {
+		return
+	}
+
+	if err := s.models.Posts.Delete(r.Context(), post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	s.audit(r, store.AuditEntry{Action: store.AuditPostDelete, ResourceType: store.ResourcePost, ResourceID: post.ID, Before: post})
+
 	err = response.JSONResponse(w, http.StatusOK, response.Envelope{"message": "post successfully deleted"})
 	if err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
@@ -182,7 +228,13 @@ func (s *server) handleListPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	posts, err := s.models.Posts.GetAll(input.Title, input.Tags, input.Filters)
+	access, err := s.postAccess(r)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	posts, err := s.models.Posts.GetAll(r.Context(), input.Title, input.Tags, access, input.Filters)
 	if err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
 		return
@@ -192,3 +244,32 @@ func (s *server) handleListPosts(w http.ResponseWriter, r *http.Request) {
 		response.ServerErrorResponse(w, r, s.logger, err)
 	}
 }
+
+// authorizePostWrite checks whether the user may change the post and sends
+// the error response when not. Posts the user cannot read are reported
+// as not found.
+func (s *server) authorizePostWrite(w http.ResponseWriter, r *http.Request, post *store.Post) bool {
+	allowed, err := s.canAccessPost(r, post, store.ActionWrite)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return false
+	}
+
+	if allowed {
+		return true
+	}
+
+	readable, err := s.canAccessPost(r, post, store.ActionRead)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return false
+	}
+
+	if readable {
+		response.NotPermittedResponse(w, r)
+	} else {
+		response.NotFoundResponse(w, r)
+	}
+
+	return false
+}
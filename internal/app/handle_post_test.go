@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/store"
+	"net/http"
+	"testing"
+)
+
+func TestChangePost(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       string
+		ownerless  bool
+		method     string
+		wantStatus int
+	}{
+		{name: "owner updates", user: "owner", method: http.MethodPatch, wantStatus: http.StatusOK},
+		{name: "owner deletes", user: "owner", method: http.MethodDelete, wantStatus: http.StatusOK},
+		{name: "writer updates", user: "writer", method: http.MethodPatch, wantStatus: http.StatusOK},
+		{name: "stranger updates", user: "stranger", method: http.MethodPatch, wantStatus: http.StatusForbidden},
+		{name: "stranger deletes", user: "stranger", method: http.MethodDelete, wantStatus: http.StatusForbidden},
+		{name: "author updates", user: "author", method: http.MethodPatch, wantStatus: http.StatusForbidden},
+		{name: "author updates ownerless", user: "author", ownerless: true, method: http.MethodPatch, wantStatus: http.StatusOK},
+		{name: "stranger deletes ownerless", user: "stranger", ownerless: true, method: http.MethodDelete, wantStatus: http.StatusForbidden},
+		{name: "anonymous updates", method: http.MethodPatch, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+
+			tokens := map[string]string{}
+			owner, ownerToken := newTestUser(t, s, "owner")
+			tokens["owner"] = ownerToken
+			writer, writerToken := newTestUser(t, s, "writer")
+			tokens["writer"] = writerToken
+			_, tokens["stranger"] = newTestUser(t, s, "stranger")
+			_, tokens["author"] = newTestUser(t, s, "author", "posts:write")
+
+			post := &store.Post{UserID: owner.ID, Title: "Post", Body: "Body"}
+			if tt.ownerless {
+				post.UserID = 0
+			}
+			if err := s.models.Posts.Insert(context.Background(), post); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := &store.ACLEntry{ResourceType: store.ResourcePost, ResourceID: &post.ID, SubjectType: store.SubjectUser, SubjectID: writer.ID, Action: store.ActionWrite}
+			if err := s.models.ACL.Insert(context.Background(), entry); err != nil {
+				t.Fatal(err)
+			}
+
+			var body string
+			if tt.method == http.MethodPatch {
+				body = `{"title": "Changed"}`
+			}
+
+			w := serveTestRequest(s, tt.method, fmt.Sprintf("/api/v1/posts/%d", post.ID), tokens[tt.user], body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("%s = %d, want %d: %s", tt.method, w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
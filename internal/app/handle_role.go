@@ -0,0 +1,342 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/request"
+	"github.com/nebisin/api_structure/pkg/response"
+	"net/http"
+	"strconv"
+)
+
+func (s *server) handleListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := s.models.Roles.GetAll(r.Context())
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"roles": roles}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+func (s *server) handleCreateRole(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string   `json:"name" validate:"required,max=100"`
+		Permissions []string `json:"permissions" validate:"unique"`
+	}
+
+	if err := request.ReadJSON(w, r, &input); err != nil {
+		response.BadRequestResponse(w, err)
+		return
+	}
+
+	if err := request.ValidateInput(&input); err != nil {
+		response.FailedValidationResponse(w, err)
+		return
+	}
+
+	ok, err := s.permissionsExist(r.Context(), input.Permissions)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if !ok {
+		response.FailedValidationResponse(w, map[string]string{"permissions": "must contain only existing permission codes"})
+		return
+	}
+
+	role := &store.Role{Name: input.Name}
+
+	err = s.models.WithTx(r.Context(), func(m store.Models) error {
+		if err := m.Roles.Insert(r.Context(), role); err != nil {
+			return err
+		}
+
+		if len(input.Permissions) == 0 {
+			return nil
+		}
+
+		return m.Roles.AddPermissions(r.Context(), role.ID, input.Permissions...)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateRole):
+			response.FailedValidationResponse(w, map[string]string{"name": "is already exist"})
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditRoleCreate,
+		ResourceType: "role",
+		ResourceID:   role.ID,
+		After:        map[string]interface{}{"name": role.Name, "permissions": input.Permissions},
+	})
+
+	s.writeRole(w, r, role.Name, http.StatusCreated)
+}
+
+func (s *server) handleAddRolePermissions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var input struct {
+		Codes []string `json:"codes" validate:"required,min=1,unique"`
+	}
+
+	if err := request.ReadJSON(w, r, &input); err != nil {
+		response.BadRequestResponse(w, err)
+		return
+	}
+
+	if err := request.ValidateInput(&input); err != nil {
+		response.FailedValidationResponse(w, err)
+		return
+	}
+
+	role, err := s.models.Roles.GetByName(r.Context(), vars["name"])
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	ok, err := s.permissionsExist(r.Context(), input.Codes)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if !ok {
+		response.FailedValidationResponse(w, map[string]string{"codes": "must contain only existing permission codes"})
+		return
+	}
+
+	if err := s.models.Roles.AddPermissions(r.Context(), role.ID, input.Codes...); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditRoleUpdate,
+		ResourceType: "role",
+		ResourceID:   role.ID,
+		Before:       role,
+		Metadata:     map[string]interface{}{"added": input.Codes},
+	})
+
+	s.writeRole(w, r, role.Name, http.StatusOK)
+}
+
+func (s *server) handleRemoveRolePermission(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	role, err := s.models.Roles.GetByName(r.Context(), vars["name"])
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	if err := s.models.Roles.RemovePermissions(r.Context(), role.ID, vars["code"]); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditRoleUpdate,
+		ResourceType: "role",
+		ResourceID:   role.ID,
+		Before:       role,
+		Metadata:     map[string]interface{}{"removed": []string{vars["code"]}},
+	})
+
+	s.writeRole(w, r, role.Name, http.StatusOK)
+}
+
+func (s *server) handleShowUserRoles(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	user, err := s.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	s.writeUserRoles(w, r, user.ID)
+}
+
+func (s *server) handleAssignUserRoles(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Roles []string `json:"roles" validate:"required,min=1,unique"`
+	}
+
+	if err := request.ReadJSON(w, r, &input); err != nil {
+		response.BadRequestResponse(w, err)
+		return
+	}
+
+	if err := request.ValidateInput(&input); err != nil {
+		response.FailedValidationResponse(w, err)
+		return
+	}
+
+	user, err := s.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	known, err := s.models.Roles.GetAll(r.Context())
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	for _, name := range input.Roles {
+		if !containsRole(known, name) {
+			response.FailedValidationResponse(w, map[string]string{"roles": "must contain only existing roles"})
+			return
+		}
+	}
+
+	if err := s.models.Roles.AddForUser(r.Context(), user.ID, input.Roles...); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditRoleAssign,
+		ResourceType: "user",
+		ResourceID:   user.ID,
+		Metadata:     map[string]interface{}{"roles": input.Roles},
+	})
+
+	s.writeUserRoles(w, r, user.ID)
+}
+
+func (s *server) handleUnassignUserRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	user, err := s.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	if err := s.models.Roles.RemoveForUser(r.Context(), user.ID, vars["role"]); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditRoleUnassign,
+		ResourceType: "user",
+		ResourceID:   user.ID,
+		Metadata:     map[string]interface{}{"roles": []string{vars["role"]}},
+	})
+
+	s.writeUserRoles(w, r, user.ID)
+}
+
+// writeRole sends the current state of a role with its permission codes.
+func (s *server) writeRole(w http.ResponseWriter, r *http.Request, name string, status int) {
+	role, err := s.models.Roles.GetByName(r.Context(), name)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if err := response.JSONResponse(w, status, response.Envelope{"role": role}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+// writeUserRoles sends the roles assigned to a user.
+func (s *server) writeUserRoles(w http.ResponseWriter, r *http.Request, userID int64) {
+	roles, err := s.models.Roles.GetAllForUser(r.Context(), userID)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"roles": roles}); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+// permissionsExist reports whether every given code is a known permission code.
+func (s *server) permissionsExist(ctx context.Context, codes []string) (bool, error) {
+	if len(codes) == 0 {
+		return true, nil
+	}
+
+	known, err := s.models.Permissions.GetAll(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, code := range codes {
+		if !containsPermission(known, code) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func containsRole(roles []*store.Role, name string) bool {
+	for i := range roles {
+		if roles[i].Name == name {
+			return true
+		}
+	}
+
+	return false
+}
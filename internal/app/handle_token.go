@@ -2,11 +2,12 @@ package app
 
 import (
 	"errors"
+	"github.com/gorilla/mux"
 	"github.com/nebisin/api_structure/internal/store"
 	"github.com/nebisin/api_structure/pkg/request"
 	"github.com/nebisin/api_structure/pkg/response"
 	"net/http"
-	"time"
+	"strconv"
 )
 
 func (s *server) handleCreateAuthenticationToken(w http.ResponseWriter, r *http.Request) {
@@ -25,10 +26,14 @@ func (s *server) handleCreateAuthenticationToken(w http.ResponseWriter, r *http.
 		return
 	}
 
-	user, err := s.models.Users.GetByEmail(input.Email)
+	user, err := s.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrRecordNotFound):
+			s.audit(r, store.AuditEntry{
+				Action:   store.AuditLoginFailed,
+				Metadata: map[string]interface{}{"email": input.Email, "reason": "unknown email"},
+			})
 			response.NotFoundResponse(w, r)
 		default:
 			response.ServerErrorResponse(w, r, s.logger, err)
@@ -43,18 +48,140 @@ func (s *server) handleCreateAuthenticationToken(w http.ResponseWriter, r *http.
 	}
 
 	if !match {
+		s.audit(r, store.AuditEntry{
+			Action:       store.AuditLoginFailed,
+			ResourceType: "user",
+			ResourceID:   user.ID,
+			Metadata:     map[string]interface{}{"email": input.Email, "reason": "invalid password"},
+		})
 		response.InvalidCredentialsResponse(w, r)
 		return
 	}
 
-	token, err := s.models.Tokens.New(user.ID, 24*time.Hour, store.ScopeAuthentication)
+	token, err := s.models.Tokens.New(r.Context(), user.ID, s.config().Tokens.AuthenticationTTL, store.ScopeAuthentication)
 	if err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
 		return
 	}
 
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditLogin,
+		ActorID:      user.ID,
+		ResourceType: "user",
+		ResourceID:   user.ID,
+	})
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditTokenCreate,
+		ActorID:      user.ID,
+		ResourceType: "token",
+		Metadata:     map[string]interface{}{"scope": token.Scope, "user_id": user.ID, "expiry": token.Expiry},
+	})
+
 	err = response.JSONResponse(w, http.StatusCreated, response.Envelope{"authentication_token": token})
 	if err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
 	}
 }
+
+// handleImpersonateUser issues a short-lived token which authenticates as
+// the target user. Requests made with it carry the X-Impersonated-By header
+// and the acting admin is available as the Impersonator of the user.
+func (s *server) handleImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		response.NotFoundResponse(w, r)
+		return
+	}
+
+	admin := s.contextGetUser(r)
+
+	if admin.Impersonator != nil || admin.ID == id {
+		response.NotPermittedResponse(w, r)
+		return
+	}
+
+	user, err := s.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrRecordNotFound):
+			response.NotFoundResponse(w, r)
+		default:
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
+		return
+	}
+
+	// Impersonation must not grant the admin anything more, and accounts
+	// holding users:impersonate are never impersonated.
+	adminPermissions, err := s.models.Permissions.GetAllForUser(r.Context(), admin.ID)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	userPermissions, err := s.models.Permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	if userPermissions.Include("users:impersonate") || !adminPermissions.Covers(userPermissions) {
+		response.NotPermittedResponse(w, r)
+		return
+	}
+
+	token, err := s.models.Tokens.NewImpersonation(r.Context(), user.ID, admin.ID, s.config().Tokens.ImpersonationTTL)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.logger.WithContext(r.Context()).WithFields(map[string]interface{}{
+		"user_id":         user.ID,
+		"impersonator_id": admin.ID,
+		"expiry":          token.Expiry,
+	}).Warn("impersonation token issued")
+
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditImpersonationStart,
+		ResourceType: "user",
+		ResourceID:   user.ID,
+		Metadata:     map[string]interface{}{"scope": token.Scope, "user_id": user.ID, "expiry": token.Expiry},
+	})
+
+	err = response.JSONResponse(w, http.StatusCreated, response.Envelope{
+		"impersonation_token": token,
+		"user":                user,
+	})
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+// handleRevokeAuthenticationTokens revokes every authentication token
+// of the current user.
+func (s *server) handleRevokeAuthenticationTokens(w http.ResponseWriter, r *http.Request) {
+	user := s.contextGetUser(r)
+
+	if user.Impersonator != nil {
+		response.NotPermittedResponse(w, r)
+		return
+	}
+
+	if err := s.models.Tokens.DeleteAllForUser(r.Context(), store.ScopeAuthentication, user.ID); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return
+	}
+
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditTokenRevoke,
+		ResourceType: "token",
+		Metadata:     map[string]interface{}{"scope": store.ScopeAuthentication, "user_id": user.ID},
+	})
+
+	err := response.JSONResponse(w, http.StatusOK, response.Envelope{"message": "authentication tokens successfully revoked"})
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
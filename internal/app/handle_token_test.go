@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nebisin/api_structure/internal/store"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestHandleImpersonateUser(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	admin, adminToken := newTestUser(t, s, "admin", "users:impersonate", "posts:write")
+	user, _ := newTestUser(t, s, "user", "posts:write")
+	moderator, _ := newTestUser(t, s, "moderator", "posts:write", "metrics:read")
+	other, _ := newTestUser(t, s, "other", "users:impersonate")
+
+	impersonate := func(token string, id int64) *http.Response {
+		w := serveTestRequest(s, http.MethodPost, "/api/v1/users/"+strconv.FormatInt(id, 10)+"/impersonation", token, "")
+		return w.Result()
+	}
+
+	for _, tt := range []struct {
+		name string
+		id   int64
+	}{
+		{name: "self", id: admin.ID},
+		{name: "user with more permissions", id: moderator.ID},
+		{name: "user allowed to impersonate", id: other.ID},
+	} {
+		if res := impersonate(adminToken, tt.id); res.StatusCode != http.StatusForbidden {
+			t.Errorf("impersonation of the %s = %d, want %d", tt.name, res.StatusCode, http.StatusForbidden)
+		}
+	}
+
+	res := impersonate(adminToken, user.ID)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("impersonation = %d, want %d", res.StatusCode, http.StatusCreated)
+	}
+
+	var issued struct {
+		Token store.Token `json:"impersonation_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&issued); err != nil {
+		t.Fatal(err)
+	}
+
+	if issued.Token.Plaintext == "" {
+		t.Fatal("no impersonation token is returned")
+	}
+
+	if res := impersonate(issued.Token.Plaintext, admin.ID); res.StatusCode != http.StatusForbidden {
+		t.Errorf("impersonation with an impersonation token = %d, want %d", res.StatusCode, http.StatusForbidden)
+	}
+
+	w := serveTestRequest(s, http.MethodPost, "/api/v1/posts", issued.Token.Plaintext, `{"title": "title", "body": "body"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("impersonated POST = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+
+	if got, want := w.Header().Get("X-Impersonated-By"), strconv.FormatInt(admin.ID, 10); got != want {
+		t.Errorf("X-Impersonated-By = %q, want %q", got, want)
+	}
+
+	ctx := context.Background()
+
+	events, _, err := s.models.Audit.GetAll(ctx, store.AuditFilter{Action: store.AuditImpersonationStart, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].ActorID != admin.ID || events[0].ResourceID != strconv.FormatInt(user.ID, 10) {
+		t.Errorf("impersonation events = %+v, want one by %d for %d", events, admin.ID, user.ID)
+	}
+
+	events, _, err = s.models.Audit.GetAll(ctx, store.AuditFilter{Action: store.AuditPostCreate, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].ActorID != user.ID || events[0].ImpersonatorID != admin.ID {
+		t.Errorf("post events = %+v, want one by %d impersonated by %d", events, user.ID, admin.ID)
+	}
+}
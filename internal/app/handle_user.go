@@ -7,19 +7,20 @@ import (
 	"github.com/nebisin/api_structure/pkg/response"
 	"net/http"
 	"strings"
-	"time"
 )
 
 func (s *server) handleRegisterUser(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name     string `json:"name" validate:"required,max=500"`
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required,max=72,min=8"`
+		Name        string `json:"name" validate:"required,max=500"`
+		Email       string `json:"email" validate:"required,email"`
+		Password    string `json:"password" validate:"required,max=72,min=8"`
+		InviteToken string `json:"invite_token" validate:"max=26"`
 	}
 
 	err := request.ReadJSON(w, r, &input)
 	if err != nil {
 		response.BadRequestResponse(w, err)
+		return
 	}
 
 	if err := request.ValidateInput(&input); err != nil {
@@ -33,47 +34,116 @@ func (s *server) handleRegisterUser(w http.ResponseWriter, r *http.Request) {
 		Activated: false,
 	}
 
+	var invitation *store.Invitation
+
+	switch {
+	case input.InviteToken != "":
+		invitation, err = s.models.Invitations.GetForToken(r.Context(), input.InviteToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrRecordNotFound):
+				response.FailedValidationResponse(w, map[string]string{"invite_token": "invalid or expired invitation token"})
+			default:
+				response.ServerErrorResponse(w, r, s.logger, err)
+			}
+			return
+		}
+
+		if invitation.Email != user.Email {
+			response.FailedValidationResponse(w, map[string]string{"invite_token": "does not belong to this email"})
+			return
+		}
+
+		user.Activated = true
+	case s.config().Registration.InviteOnly:
+		response.FailedValidationResponse(w, map[string]string{"invite_token": "must be provided"})
+		return
+	}
+
 	if err := user.Password.Set(input.Password); err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
 		return
 	}
 
-	if err := s.models.Users.Insert(user); err != nil {
+	var token *store.Token
+
+	// Invited users get the roles of their invitation,
+	// or the default registration role when it has none.
+	roles := []string{s.config().Registration.DefaultRole}
+	if invitation != nil && len(invitation.Roles) > 0 {
+		roles = invitation.Roles
+	}
+
+	err = s.models.WithTx(r.Context(), func(m store.Models) error {
+		if err := m.Users.Insert(r.Context(), user); err != nil {
+			return err
+		}
+
+		if invitation != nil {
+			if err := m.Invitations.MarkAccepted(r.Context(), invitation); err != nil {
+				return err
+			}
+		}
+
+		if err := m.Roles.AddForUser(r.Context(), user.ID, roles...); err != nil {
+			return err
+		}
+
+		if invitation != nil {
+			return nil
+		}
+
+		token, err = m.Tokens.New(r.Context(), user.ID, s.config().Tokens.ActivationTTL, store.ScopeActivation)
+		if err != nil {
+			return err
+		}
+
+		data := map[string]interface{}{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		}
+
+		return s.enqueueMail(r.Context(), m, user.Email, "user_welcome.tmpl", data)
+	})
+	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrDuplicateEmail):
 			errs := map[string]string{"email": "is already exist"}
 			response.FailedValidationResponse(w, errs)
+		case errors.Is(err, store.ErrEditConflict):
+			response.FailedValidationResponse(w, map[string]string{"invite_token": "invalid or expired invitation token"})
 		default:
 			response.ServerErrorResponse(w, r, s.logger, err)
 		}
 		return
 	}
 
-	err = s.models.Permissions.AddForUser(user.ID, "posts:read")
-	if err != nil {
-		response.ServerErrorResponse(w, r, s.logger, err)
-		return
-	}
+	if invitation != nil {
+		s.audit(r, store.AuditEntry{
+			Action:       store.AuditRoleAssign,
+			ActorID:      user.ID,
+			ResourceType: "user",
+			ResourceID:   user.ID,
+			After:        roles,
+			Metadata:     map[string]interface{}{"invitation_id": invitation.ID},
+		})
 
-	token, err := s.models.Tokens.New(user.ID, 3*24*time.Hour, store.ScopeActivation)
-	if err != nil {
-		response.ServerErrorResponse(w, r, s.logger, err)
+		err = response.JSONResponse(w, http.StatusCreated, response.Envelope{"user": user})
+		if err != nil {
+			response.ServerErrorResponse(w, r, s.logger, err)
+		}
 		return
 	}
 
-	s.background(func() {
-		data := map[string]interface{}{
-			"activationToken": token.Plaintext,
-			"userID":          user.ID,
-		}
-		if err := s.mailer.Send(user.Email, "user_welcome.tmpl", data); err != nil {
-			s.logger.WithFields(map[string]interface{}{
-				"request_method": r.Method,
-				"request_url":    r.URL.String(),
-			}).WithError(err).Error("background email error")
-		}
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditTokenCreate,
+		ActorID:      user.ID,
+		ResourceType: "token",
+		Metadata:     map[string]interface{}{"scope": token.Scope, "user_id": user.ID, "expiry": token.Expiry},
 	})
 
+	s.wakeOutbox()
+
 	err = response.JSONResponse(w, http.StatusAccepted, response.Envelope{"user": user})
 	if err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
@@ -95,7 +165,7 @@ func (s *server) handleActivateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := s.models.Users.GetForToken(store.ScopeActivation, input.TokenPlainText)
+	user, err := s.models.Users.GetForToken(r.Context(), store.ScopeActivation, input.TokenPlainText)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrRecordNotFound):
@@ -108,7 +178,19 @@ func (s *server) handleActivateUser(w http.ResponseWriter, r *http.Request) {
 
 	user.Activated = true
 
-	if err := s.models.Users.Update(user); err != nil {
+	version := user.Version
+
+	err = s.models.WithTx(r.Context(), func(m store.Models) error {
+		// The transaction may be retried after Update has bumped the version.
+		user.Version = version
+
+		if err := m.Users.Update(r.Context(), user); err != nil {
+			return err
+		}
+
+		return m.Tokens.DeleteAllForUser(r.Context(), store.ScopeActivation, user.ID)
+	})
+	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrEditConflict):
 			response.EditConflictResponse(w)
@@ -118,10 +200,12 @@ func (s *server) handleActivateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.models.Tokens.DeleteAllForUser(store.ScopeActivation, user.ID); err != nil {
-		response.ServerErrorResponse(w, r, s.logger, err)
-		return
-	}
+	s.audit(r, store.AuditEntry{
+		Action:       store.AuditTokenRevoke,
+		ActorID:      user.ID,
+		ResourceType: "token",
+		Metadata:     map[string]interface{}{"scope": store.ScopeActivation, "user_id": user.ID},
+	})
 
 	if err := response.JSONResponse(w, http.StatusOK, response.Envelope{"user": user}); err != nil {
 		response.ServerErrorResponse(w, r, s.logger, err)
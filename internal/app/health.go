@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/migrate"
+	"github.com/nebisin/api_structure/pkg/response"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// readinessCheck is a dependency which must be available to serve requests.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// checkResult is the outcome of a readiness check.
+type checkResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// readinessChecks returns the checks of the configured dependencies.
+func (s *server) readinessChecks() []readinessCheck {
+	var checks []readinessCheck
+
+	if s.db != nil {
+		checks = append(checks, readinessCheck{name: "database", check: s.db.PingContext})
+	}
+
+	if s.migrator != nil {
+		checks = append(checks, readinessCheck{name: "migrations", check: s.checkMigrations})
+	}
+
+	if cfg := s.config(); cfg.Health.CheckSMTP && cfg.Mailer.Backend == "smtp" {
+		checks = append(checks, readinessCheck{name: "smtp", check: s.mailer.Ping})
+	}
+
+	return checks
+}
+
+// checkMigrations fails unless the database schema is at the version of the
+// last migration embedded in the binary.
+func (s *server) checkMigrations(ctx context.Context) error {
+	version, dirty, err := s.migrator.CurrentVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		return migrate.ErrDirty
+	}
+
+	if latest := s.migrator.Latest(); version != latest {
+		return fmt.Errorf("database is at version %d, expected %d", version, latest)
+	}
+
+	return nil
+}
+
+// handleLivez reports that the process is running and able to serve.
+func (s *server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	err := response.JSONResponse(w, http.StatusOK, response.Envelope{"status": "alive"})
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
+
+// handleReadyz runs the readiness checks concurrently and reports each of
+// them. The server is not ready when a check fails or once it is shutting
+// down, so the load balancers stop sending it requests.
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config().Health.Timeout)
+	defer cancel()
+
+	checks := s.readinessChecks()
+	results := make([]checkResult, len(checks))
+
+	var wg sync.WaitGroup
+
+	for i, c := range checks {
+		wg.Add(1)
+
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := c.check(ctx)
+
+			results[i] = checkResult{Status: "up", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				results[i].Status = "down"
+				results[i].Error = err.Error()
+			}
+		}(i, c)
+	}
+
+	wg.Wait()
+
+	status, code := "ready", http.StatusOK
+	report := make(map[string]checkResult, len(checks))
+
+	for i, c := range checks {
+		report[c.name] = results[i]
+
+		if results[i].Status != "up" {
+			status, code = "not ready", http.StatusServiceUnavailable
+
+			s.logger.WithContext(r.Context()).WithFields(map[string]interface{}{
+				"check": c.name,
+				"error": results[i].Error,
+			}).Warn("readiness check failed")
+		}
+	}
+
+	env := response.Envelope{"status": status, "checks": report}
+
+	if atomic.LoadInt32(&s.draining) == 1 {
+		env["status"], code = "shutting down", http.StatusServiceUnavailable
+	}
+
+	if err := response.JSONResponse(w, code, env); err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+	}
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/nebisin/api_structure/internal/config"
+	"github.com/nebisin/api_structure/internal/mailer"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthEndpointsBypassTheMiddleware(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.IPFilter.Rules = []config.IPFilterRule{{PathPrefix: "/", Deny: []string{"0.0.0.0/0"}}}
+		cfg.Limiter.RPS, cfg.Limiter.Burst = 0.001, 1
+	})
+
+	if w := serveTestRequest(s, http.MethodGet, "/api/v1/healthcheck", "", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("/api/v1/healthcheck = %d, want the IP filter to reject it with %d", w.Code, http.StatusForbidden)
+	}
+
+	for _, path := range []string{"/livez", "/readyz"} {
+		for i := 0; i < 3; i++ {
+			w := serveTestRequest(s, http.MethodGet, path, "invalid", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s = %d, want %d: %s", path, w.Code, http.StatusOK, w.Body)
+			}
+
+			if w.Header().Get("RateLimit-Limit") != "" {
+				t.Errorf("%s is rate limited", path)
+			}
+		}
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		smtp       bool
+		draining   bool
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "ready", wantStatus: http.StatusOK, wantBody: "ready"},
+		{name: "failing check", smtp: true, wantStatus: http.StatusServiceUnavailable, wantBody: "not ready"},
+		{name: "draining", draining: true, wantStatus: http.StatusServiceUnavailable, wantBody: "shutting down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.Health.Timeout = time.Second
+				if tt.smtp {
+					cfg.Mailer.Backend = "smtp"
+					cfg.Health.CheckSMTP = true
+				}
+			})
+
+			if tt.smtp {
+				s.mailer = mailer.New(mailer.NewSMTP("127.0.0.1", 1, "", ""), s.config().SMTP.Sender)
+			}
+
+			if tt.draining {
+				atomic.StoreInt32(&s.draining, 1)
+			}
+
+			w := serveTestRequest(s, http.MethodGet, "/readyz", "", "")
+			if w.Code != tt.wantStatus {
+				t.Errorf("/readyz = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			var body struct {
+				Status string                 `json:"status"`
+				Checks map[string]checkResult `json:"checks"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			if body.Status != tt.wantBody {
+				t.Errorf("status = %q, want %q", body.Status, tt.wantBody)
+			}
+
+			if tt.smtp && body.Checks["smtp"].Status != "down" {
+				t.Errorf("smtp check = %+v, want down", body.Checks["smtp"])
+			}
+		})
+	}
+}
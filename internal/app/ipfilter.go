@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/nebisin/api_structure/internal/config"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/realip"
+	"net"
+	"strings"
+	"time"
+)
+
+// ipFilter holds the IP rules of the configuration and of the store,
+// checked by the filterIP middleware.
+type ipFilter struct {
+	rules []ipFilterRule
+}
+
+type ipFilterRule struct {
+	prefix  string
+	allow   bool
+	network *net.IPNet
+	// source names the rule in the logs of the blocked requests.
+	source string
+}
+
+func newIPFilter(configured []*store.IPRule, managed []*store.IPRule) (*ipFilter, error) {
+	f := &ipFilter{}
+
+	for _, rule := range append(configured, managed...) {
+		network, err := realip.ParseNetwork(rule.CIDR)
+		if err != nil {
+			return nil, err
+		}
+
+		source := "config"
+		if rule.ID != 0 {
+			source = fmt.Sprintf("ip_rule %d", rule.ID)
+		}
+
+		f.rules = append(f.rules, ipFilterRule{
+			prefix:  rule.PathPrefix,
+			allow:   rule.Action == store.IPRuleAllow,
+			network: network,
+			source:  source,
+		})
+	}
+
+	return f, nil
+}
+
+// check reports whether the requests from ip are allowed to path. A
+// request is denied when a deny rule of one of the prefixes of the path
+// matches it. Otherwise, when allow rules exist for a prefix of the path,
+// one of the rules of the longest such prefix has to match it. The source
+// of the deny rule, or of the allow list, is returned with a denial.
+func (f *ipFilter) check(path string, ip net.IP) (bool, string) {
+	allowPrefix := ""
+	allowed := false
+
+	for _, rule := range f.rules {
+		if !matchPathPrefix(path, rule.prefix) {
+			continue
+		}
+
+		if !rule.allow {
+			if ip != nil && rule.network.Contains(ip) {
+				return false, rule.source
+			}
+			continue
+		}
+
+		switch {
+		case len(rule.prefix) > len(allowPrefix):
+			allowPrefix = rule.prefix
+			allowed = ip != nil && rule.network.Contains(ip)
+		case rule.prefix == allowPrefix && !allowed:
+			allowed = ip != nil && rule.network.Contains(ip)
+		}
+	}
+
+	if allowPrefix != "" && !allowed {
+		return false, "allow list of " + allowPrefix
+	}
+
+	return true, ""
+}
+
+// matchPathPrefix reports whether path is prefix or a path under it.
+func matchPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// getIPFilter returns the current IP filter.
+func (s *server) getIPFilter() *ipFilter {
+	return s.ipFilter.Load().(*ipFilter)
+}
+
+// refreshIPFilter rebuilds the IP filter from the rules of the current
+// configuration and of the store. The current filter stays in effect
+// when an error is returned.
+func (s *server) refreshIPFilter(ctx context.Context) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	filter, err := s.loadIPFilter(ctx, s.config())
+	if err != nil {
+		return err
+	}
+
+	s.ipFilter.Store(filter)
+
+	return nil
+}
+
+// loadIPFilter builds the IP filter from the rules of cfg and of the store.
+func (s *server) loadIPFilter(ctx context.Context, cfg *config.Config) (*ipFilter, error) {
+	var configured []*store.IPRule
+
+	for _, rule := range cfg.IPFilter.Rules {
+		for _, cidr := range rule.Deny {
+			configured = append(configured, &store.IPRule{PathPrefix: rule.PathPrefix, Action: store.IPRuleDeny, CIDR: cidr})
+		}
+		for _, cidr := range rule.Allow {
+			configured = append(configured, &store.IPRule{PathPrefix: rule.PathPrefix, Action: store.IPRuleAllow, CIDR: cidr})
+		}
+	}
+
+	managed, err := s.models.IPRules.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newIPFilter(configured, managed)
+}
+
+// setupIPFilter loads the IP filter and refreshes it periodically, so the
+// rules managed through another instance are picked up.
+func (s *server) setupIPFilter() {
+	if err := s.refreshIPFilter(context.Background()); err != nil {
+		s.logger.WithError(err).Fatal("an error occurred while loading the ip rules")
+	}
+
+	interval := s.config().IPFilter.RefreshInterval
+
+	s.background("ip rule refresh", func() {
+		for {
+			time.Sleep(interval)
+
+			if err := s.refreshIPFilter(context.Background()); err != nil {
+				s.logger.WithError(err).Error("an error occurred while refreshing the ip rules")
+			}
+		}
+	})
+}
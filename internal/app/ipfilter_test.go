@@ -0,0 +1,55 @@
+package app
+
+import (
+	"github.com/nebisin/api_structure/internal/store"
+	"net"
+	"testing"
+)
+
+func TestIPFilterCheck(t *testing.T) {
+	configured := []*store.IPRule{
+		{PathPrefix: "/", Action: store.IPRuleDeny, CIDR: "192.0.2.0/24"},
+		{PathPrefix: "/api/v1/roles", Action: store.IPRuleAllow, CIDR: "10.0.0.0/8"},
+		{PathPrefix: "/api/v1/roles/admin", Action: store.IPRuleAllow, CIDR: "10.1.0.0/16"},
+		{PathPrefix: "/api/v1/roles/admin", Action: store.IPRuleAllow, CIDR: "10.2.0.1"},
+	}
+	managed := []*store.IPRule{
+		{ID: 7, PathPrefix: "/api/v1/roles", Action: store.IPRuleDeny, CIDR: "10.9.0.0/16"},
+	}
+
+	filter, err := newIPFilter(configured, managed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		ip         string
+		wantAllow  bool
+		wantSource string
+	}{
+		{"no rules", "/api/v1/posts", "203.0.113.1", true, ""},
+		{"global deny", "/api/v1/posts", "192.0.2.10", false, "config"},
+		{"global deny before allow list", "/api/v1/roles", "192.0.2.10", false, "config"},
+		{"allow list", "/api/v1/roles", "10.3.0.1", true, ""},
+		{"allow list under prefix", "/api/v1/roles/5", "10.3.0.1", true, ""},
+		{"outside allow list", "/api/v1/roles", "203.0.113.1", false, "allow list of /api/v1/roles"},
+		{"prefix is a whole segment", "/api/v1/rolesx", "203.0.113.1", true, ""},
+		{"managed deny", "/api/v1/roles", "10.9.1.1", false, "ip_rule 7"},
+		{"longest allow list", "/api/v1/roles/admin", "10.1.2.3", true, ""},
+		{"longest allow list other rule", "/api/v1/roles/admin", "10.2.0.1", true, ""},
+		{"outside longest allow list", "/api/v1/roles/admin", "10.3.0.1", false, "allow list of /api/v1/roles/admin"},
+		{"unknown address", "/api/v1/roles", "", false, "allow list of /api/v1/roles"},
+		{"unknown address without rules", "/api/v1/posts", "", true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, source := filter.check(tt.path, net.ParseIP(tt.ip))
+			if allowed != tt.wantAllow || source != tt.wantSource {
+				t.Errorf("check(%q, %q) = %v, %q, want %v, %q", tt.path, tt.ip, allowed, source, tt.wantAllow, tt.wantSource)
+			}
+		})
+	}
+}
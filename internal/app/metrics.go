@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// metrics holds the Prometheus collectors of the server, exposed on
+// /metrics.
+type metrics struct {
+	registry            *prometheus.Registry
+	requests            *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	rateLimitRejections *prometheus.CounterVec
+	mailSends           *prometheus.CounterVec
+	outboxDeadLetters   prometheus.Counter
+	backgroundTasks     prometheus.Gauge
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "api",
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "api",
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of the HTTP requests by method and route template.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		rateLimitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "api",
+			Name:      "rate_limit_rejections_total",
+			Help:      "Number of requests rejected by the rate limiter by client kind.",
+		}, []string{"client"}),
+		mailSends: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "api",
+			Name:      "mail_sends_total",
+			Help:      "Number of emails sent by template and result.",
+		}, []string{"template", "result"}),
+		outboxDeadLetters: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "api",
+			Name:      "outbox_dead_letters_total",
+			Help:      "Number of emails of the outbox given up after the last attempt.",
+		}),
+		backgroundTasks: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "api",
+			Name:      "background_tasks",
+			Help:      "Number of background tasks in flight, such as the outbox workers.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.rateLimitRejections,
+		m.mailSends,
+		m.outboxDeadLetters,
+		m.backgroundTasks,
+	)
+
+	return m
+}
+
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// statusRecorder records the status code and the size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += n
+	return n, err
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// instrument records the count and the duration of the requests, labeled
+// with the template of the matched route so the label values stay bounded.
+func (s *server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		s.metrics.requests.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+		s.metrics.requestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// sendMail sends an email and records its result.
+func (s *server) sendMail(ctx context.Context, recipient, templateFile string, data interface{}) error {
+	err := s.mailer.Send(ctx, recipient, templateFile, data)
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	s.metrics.mailSends.WithLabelValues(templateFile, result).Inc()
+
+	return err
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"github.com/nebisin/api_structure/internal/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Metrics.Enabled = true
+	})
+
+	_, reader := newTestUser(t, s, "reader")
+	_, scraper := newTestUser(t, s, "scraper", "metrics:read")
+
+	serveTestRequest(s, http.MethodGet, "/api/v1/healthcheck", "", "")
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"without metrics:read", reader, http.StatusForbidden},
+		{"with metrics:read", scraper, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTestRequest(s, http.MethodGet, "/metrics", tt.token, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("/metrics = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			for _, want := range []string{
+				`api_http_requests_total{method="GET",route="/api/v1/healthcheck",status="200"} 1`,
+				"api_background_tasks",
+				"go_goroutines",
+			} {
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("/metrics does not report %s", want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackgroundTasksGauge(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Outbox.Workers = 2
+	})
+
+	stop := s.startOutbox()
+
+	if got := testutil.ToFloat64(s.metrics.backgroundTasks); got != 3 {
+		t.Errorf("background tasks = %v, want the 2 workers and the cleanup", got)
+	}
+
+	stop()
+
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(s.metrics.backgroundTasks) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := testutil.ToFloat64(s.metrics.backgroundTasks); got != 0 {
+		t.Errorf("background tasks after stopping the outbox = %v, want 0", got)
+	}
+}
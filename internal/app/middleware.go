@@ -4,12 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/realip"
 	"github.com/nebisin/api_structure/pkg/response"
-	"golang.org/x/time/rate"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
 )
 
 func (s *server) recoverPanic(next http.Handler) http.Handler {
@@ -25,34 +26,109 @@ func (s *server) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-// rateLimit is the rate limiter middleware
-func (s *server) rateLimit(next http.Handler) http.Handler {
+// resolveClientIP stores the IP address of the client, as resolved through
+// the trusted proxies, in the request context.
+func (s *server) resolveClientIP(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			response.ServerErrorResponse(w, r, s.logger, err)
+		ctx := realip.NewContext(r.Context(), s.realIP.ClientIP(r))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// filterIP blocks the requests which the IP rules deny.
+func (s *server) filterIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP := realip.FromContext(r.Context())
+
+		if allowed, source := s.getIPFilter().check(r.URL.Path, net.ParseIP(clientIP)); !allowed {
+			s.logger.WithContext(r.Context()).WithFields(map[string]interface{}{
+				"request_method": r.Method,
+				"request_url":    r.URL.String(),
+				"client_ip":      clientIP,
+				"rule":           source,
+			}).Warn("blocked request")
+
+			response.IPBlockedResponse(w, r)
+			return
 		}
 
-		s.limiter.mu.Lock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitIP is the rate limiter middleware which counts every request by the
+// IP address of the client. It runs before authentication, so clients
+// guessing tokens are limited as well.
+func (s *server) limitIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.config()
 
-		if _, found := s.limiter.clients[ip]; !found {
-			s.limiter.clients[ip] = &client{limiter: rate.NewLimiter(2, 4)}
+		if !cfg.Limiter.Enabled {
+			next.ServeHTTP(w, r)
+			return
 		}
 
-		s.limiter.clients[ip].lastSeen = time.Now()
+		if s.allowRequest(w, r, s.ipLimitPolicy(r, cfg), "ip") {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// limitUser is the rate limiter middleware which counts the requests of
+// authenticated users by their id, after they are counted by IP address.
+func (s *server) limitUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.config()
+		user := s.contextGetUser(r)
 
-		if !s.limiter.clients[ip].limiter.Allow() {
-			s.limiter.mu.Unlock()
-			response.RateLimitExceededResponse(w, r)
+		if !cfg.Limiter.Enabled || user.IsAnonymous() {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		s.limiter.mu.Unlock()
+		policy, err := s.userLimitPolicy(r, cfg, user)
+		if err != nil {
+			response.ServerErrorResponse(w, r, s.logger, err)
+			return
+		}
 
-		next.ServeHTTP(w, r)
+		if s.allowRequest(w, r, policy, "user") {
+			next.ServeHTTP(w, r)
+		}
 	})
 }
 
+// allowRequest counts the request in the bucket of the policy and reports
+// whether it is allowed, writing the response otherwise. It reports the
+// limit of the request and the requests left in the RateLimit-Limit and
+// RateLimit-Remaining headers, and when to retry a rejected request in
+// the Retry-After header. A request counted in several buckets reports the
+// one with the fewest requests left.
+func (s *server) allowRequest(w http.ResponseWriter, r *http.Request, policy limitPolicy, client string) bool {
+	result, err := s.limiter.Allow(r.Context(), policy.key, policy.limit, policy.burst)
+	if err != nil {
+		response.ServerErrorResponse(w, r, s.logger, err)
+		return false
+	}
+
+	remaining, err := strconv.Atoi(w.Header().Get("RateLimit-Remaining"))
+	if err != nil || result.Remaining < remaining {
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	}
+
+	if !result.Allowed {
+		s.metrics.rateLimitRejections.WithLabelValues(client).Inc()
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+		response.RateLimitExceededResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
 // authenticate is the authentication middleware
 func (s *server) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -78,7 +154,7 @@ func (s *server) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := s.models.Users.GetForToken(store.ScopeAuthentication, token)
+		user, impersonatorID, err := s.models.Users.GetForAuthentication(r.Context(), token)
 		if err != nil {
 			switch {
 			case errors.Is(err, store.ErrRecordNotFound):
@@ -89,12 +165,51 @@ func (s *server) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		if impersonatorID != 0 {
+			user.Impersonator, err = s.models.Users.Get(r.Context(), impersonatorID)
+			if err != nil {
+				switch {
+				case errors.Is(err, store.ErrRecordNotFound):
+					response.InvalidAuthenticationTokenResponse(w, r)
+				default:
+					response.ServerErrorResponse(w, r, s.logger, err)
+				}
+				return
+			}
+
+			w.Header().Set("X-Impersonated-By", strconv.FormatInt(impersonatorID, 10))
+		}
+
 		r = s.contextSetUser(r, user)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// auditImpersonation logs every mutating request which is made with an
+// impersonation token, with both the impersonated and the acting user.
+func (s *server) auditImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := s.contextGetUser(r)
+
+		if user.Impersonator != nil {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				s.logger.WithContext(r.Context()).WithFields(map[string]interface{}{
+					"request_method":  r.Method,
+					"request_url":     r.URL.String(),
+					"client_ip":       realip.FromContext(r.Context()),
+					"user_id":         user.ID,
+					"impersonator_id": user.Impersonator.ID,
+				}).Warn("impersonated request")
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (s *server) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := s.contextGetUser(r)
@@ -127,7 +242,7 @@ func (s *server) requirePermission(code string, next http.HandlerFunc) http.Hand
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		user := s.contextGetUser(r)
 
-		permissions, err := s.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := s.models.Permissions.GetAllForUser(r.Context(), user.ID)
 		if err != nil {
 			response.ServerErrorResponse(w, r, s.logger, err)
 			return
@@ -150,10 +265,11 @@ func (s *server) enableCORS(next http.Handler) http.Handler {
 		w.Header().Add("Vary", "Access-Control-Request-Method")
 
 		origin := r.Header.Get("Origin")
+		trustedOrigins := s.config().CORS.TrustedOrigins
 
-		if origin != "" && len(s.config.cors.trustedOrigins) != 0 {
-			for i := range s.config.cors.trustedOrigins {
-				if origin == s.config.cors.trustedOrigins[i] {
+		if origin != "" && len(trustedOrigins) != 0 {
+			for i := range trustedOrigins {
+				if origin == trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/requestid"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// enqueueMail adds an email to the outbox through m, which are the models
+// of the transaction of the change triggering the email, so the email is
+// sent if and only if the change is committed.
+func (s *server) enqueueMail(ctx context.Context, m store.Models, recipient, templateFile string, data interface{}) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return m.Outbox.Insert(ctx, &store.OutboxMessage{
+		Recipient: recipient,
+		Template:  templateFile,
+		Data:      js,
+		RequestID: requestid.FromContext(ctx),
+	})
+}
+
+// wakeOutbox makes an idle worker check the outbox without waiting for the
+// poll interval, it is called once an email is committed to the outbox.
+func (s *server) wakeOutbox() {
+	select {
+	case s.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// startOutbox starts the workers sending the emails of the outbox and the
+// deletion of the sent emails past the retention. The returned function
+// stops them, after the emails being sent.
+func (s *server) startOutbox() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < s.config().Outbox.Workers; i++ {
+		wg.Add(1)
+
+		s.background("outbox worker", func() {
+			defer wg.Done()
+			s.outboxWorker(ctx)
+		})
+	}
+
+	wg.Add(1)
+
+	s.background("outbox cleanup", func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			before := time.Now().Add(-s.config().Outbox.Retention)
+			if _, err := s.models.Outbox.DeleteSent(ctx, before); err != nil && ctx.Err() == nil {
+				s.logger.WithError(err).Error("an error occurred while deleting the sent emails of the outbox")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// outboxWorker sends the due emails one at a time until ctx is canceled.
+func (s *server) outboxWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		cfg := s.config()
+
+		messages, err := s.models.Outbox.Claim(ctx, 1, cfg.Outbox.Lease)
+		if err != nil && ctx.Err() == nil {
+			s.logger.WithError(err).Error("an error occurred while claiming the emails of the outbox")
+		}
+
+		for _, msg := range messages {
+			s.deliverOutboxMessage(msg)
+		}
+
+		if len(messages) > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-s.outboxWake:
+		case <-time.After(cfg.Outbox.PollInterval):
+		}
+	}
+}
+
+// deliverOutboxMessage sends a claimed email and records the result: the
+// email is marked as sent, scheduled for another attempt, or dead-lettered
+// after the last attempt. The result is dropped when the lease expired and
+// the email has been claimed again, which may then send it twice.
+func (s *server) deliverOutboxMessage(msg *store.OutboxMessage) {
+	cfg := s.config()
+	ctx := requestid.NewContext(context.Background(), msg.RequestID)
+
+	var data map[string]interface{}
+
+	err := json.Unmarshal(msg.Data, &data)
+	if err == nil {
+		err = s.sendMail(ctx, msg.Recipient, msg.Template, data)
+	}
+
+	logger := s.logger.WithContext(ctx).WithFields(map[string]interface{}{
+		"outbox_id": msg.ID,
+		"template":  msg.Template,
+		"attempts":  msg.Attempts,
+	})
+
+	var result error
+
+	switch {
+	case err == nil:
+		result = s.models.Outbox.MarkSent(ctx, msg)
+	case msg.Attempts >= cfg.Outbox.MaxAttempts:
+		logger.WithError(err).Error("email dead-lettered after the last attempt")
+		s.metrics.outboxDeadLetters.Inc()
+
+		result = s.models.Outbox.MarkDead(ctx, msg, err.Error())
+	default:
+		retryAt := time.Now().Add(outboxBackoff(msg.Attempts, cfg.Outbox.InitialBackoff, cfg.Outbox.MaxBackoff))
+		logger.WithError(err).WithField("retry_at", retryAt.Format(time.RFC3339)).Warn("email send failed")
+
+		result = s.models.Outbox.Retry(ctx, msg, err.Error(), retryAt)
+	}
+
+	switch {
+	case errors.Is(result, store.ErrEditConflict):
+		logger.Warn("email claimed again after its lease expired")
+	case result != nil:
+		logger.WithError(result).Error("an error occurred while updating the outbox")
+	}
+}
+
+// outboxBackoff returns the delay before the attempt following the given
+// number of attempts. It doubles from initial with every attempt up to max,
+// half of it being random so the retries of many emails spread out.
+func outboxBackoff(attempts int, initial, max time.Duration) time.Duration {
+	d := initial
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
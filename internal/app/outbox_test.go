@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"github.com/nebisin/api_structure/internal/config"
+	"github.com/nebisin/api_structure/internal/mailer"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/sirupsen/logrus"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{7, 30 * time.Minute},
+		{8, 30 * time.Minute},
+		{100, 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := outboxBackoff(tt.attempts, 30*time.Second, 30*time.Minute)
+			if got < tt.want/2 || got > tt.want {
+				t.Fatalf("outboxBackoff(%d) = %s, want between %s and %s", tt.attempts, got, tt.want/2, tt.want)
+			}
+		}
+	}
+}
+
+func TestDeliverOutboxMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    string
+		attempts    int
+		reclaimed   bool
+		wantStatus  string
+		wantSent    int
+		wantError   bool
+		wantRetried bool
+	}{
+		{name: "sent", template: "user_welcome.tmpl", attempts: 1, wantStatus: store.OutboxSent, wantSent: 1},
+		{name: "retried", template: "missing.tmpl", attempts: 1, wantStatus: store.OutboxPending, wantError: true, wantRetried: true},
+		{name: "dead-lettered", template: "missing.tmpl", attempts: 3, wantStatus: store.OutboxDead, wantError: true},
+		{name: "claimed again", template: "user_welcome.tmpl", attempts: 1, reclaimed: true, wantStatus: store.OutboxPending, wantSent: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+
+			cfg := config.Default()
+			cfg.Outbox.MaxAttempts = 3
+
+			sender := mailer.NewMemory()
+			s := &server{
+				logger:  logger,
+				metrics: newMetrics(),
+				mailer:  mailer.New(sender, "API <no-reply@example.com>"),
+				models:  store.NewMemoryModels(nil),
+			}
+			s.configValue.Store(cfg)
+
+			err := s.enqueueMail(ctx, s.models, "alice@example.com", tt.template, map[string]interface{}{"userID": 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var msg *store.OutboxMessage
+
+			for i := 0; i < tt.attempts; i++ {
+				messages, err := s.models.Outbox.Claim(ctx, 1, 0)
+				if err != nil || len(messages) != 1 {
+					t.Fatalf("Claim() = %v, %v, want a message", messages, err)
+				}
+				msg = messages[0]
+			}
+
+			if tt.reclaimed {
+				if _, err := s.models.Outbox.Claim(ctx, 1, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			start := time.Now()
+			s.deliverOutboxMessage(msg)
+
+			stored, err := s.models.Outbox.Get(ctx, msg.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stored.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", stored.Status, tt.wantStatus)
+			}
+
+			if got := len(sender.SentTo("alice@example.com")); got != tt.wantSent {
+				t.Errorf("sent %d emails, want %d", got, tt.wantSent)
+			}
+
+			if got := stored.LastError != ""; got != tt.wantError {
+				t.Errorf("last error = %q, want an error: %v", stored.LastError, tt.wantError)
+			}
+
+			// The memory store rounds the times to the second, and the first
+			// retry is at least 15s away.
+			if got := stored.NextAttemptAt.After(start.Add(5 * time.Second)); got != tt.wantRetried {
+				t.Errorf("next attempt at %s, want a retry: %v", stored.NextAttemptAt, tt.wantRetried)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"github.com/nebisin/api_structure/internal/store"
+	"net/http"
+)
+
+// postModeratePermission lets a user read and change every post
+// regardless of ownership and ACL entries.
+const postModeratePermission = "posts:moderate"
+
+// canAccessPost is the policy helper for single posts. The action is
+// allowed when the user
+//
+//  1. holds the posts:moderate permission, or
+//  2. owns the post, or
+//  3. holds the posts:write permission and the post has no owner, or
+//  4. asks to read a post which is not private, or
+//  5. is granted the action, directly or through a role, by an ACL entry
+//     for the post or for every post. A write grant implies read.
+func (s *server) canAccessPost(r *http.Request, post *store.Post, action string) (bool, error) {
+	user := s.contextGetUser(r)
+
+	moderator, err := s.hasPermission(r.Context(), user, postModeratePermission)
+	if err != nil || moderator {
+		return moderator, err
+	}
+
+	if !user.IsAnonymous() && post.UserID == user.ID {
+		return true, nil
+	}
+
+	if post.UserID == 0 {
+		writer, err := s.hasPermission(r.Context(), user, "posts:write")
+		if err != nil || writer {
+			return writer, err
+		}
+	}
+
+	if action == store.ActionRead && !post.Private {
+		return true, nil
+	}
+
+	if user.IsAnonymous() {
+		return false, nil
+	}
+
+	actions := []string{store.ActionWrite}
+	if action == store.ActionRead {
+		actions = append(actions, store.ActionRead)
+	}
+
+	return s.models.ACL.Allowed(r.Context(), store.ResourcePost, post.ID, user.ID, actions...)
+}
+
+// postAccess returns the visibility filter used when listing posts
+// for the user of the request.
+func (s *server) postAccess(r *http.Request) (store.PostAccess, error) {
+	user := s.contextGetUser(r)
+
+	moderator, err := s.hasPermission(r.Context(), user, postModeratePermission)
+	if err != nil {
+		return store.PostAccess{}, err
+	}
+
+	return store.PostAccess{UserID: user.ID, All: moderator}, nil
+}
+
+func (s *server) hasPermission(ctx context.Context, user *store.User, code string) (bool, error) {
+	if user.IsAnonymous() {
+		return false, nil
+	}
+
+	permissions, err := s.models.Permissions.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include(code), nil
+}
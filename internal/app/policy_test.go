@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"github.com/nebisin/api_structure/internal/store"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanAccessPost(t *testing.T) {
+	ctx := context.Background()
+	s := &server{models: store.NewMemoryModels(nil)}
+
+	users := map[string]*store.User{}
+	for _, name := range []string{"owner", "moderator", "reader", "writer", "role writer", "author", "stranger"} {
+		user := &store.User{Name: name, Email: name + "@example.com", Activated: true}
+		if err := s.models.Users.Insert(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		users[name] = user
+	}
+	users["anonymous"] = store.AnonymousUser
+
+	if err := s.models.Roles.AddForUser(ctx, users["moderator"].ID, "editor"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.models.Permissions.AddForUser(ctx, users["author"].ID, "posts:write"); err != nil {
+		t.Fatal(err)
+	}
+
+	public := &store.Post{UserID: users["owner"].ID, Title: "Public"}
+	private := &store.Post{UserID: users["owner"].ID, Title: "Private", Private: true}
+	ownerless := &store.Post{Title: "Ownerless"}
+	for _, post := range []*store.Post{public, private, ownerless} {
+		if err := s.models.Posts.Insert(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	author, err := s.models.Roles.GetByName(ctx, "author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.models.Roles.AddForUser(ctx, users["role writer"].ID, author.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []*store.ACLEntry{
+		{ResourceType: store.ResourcePost, ResourceID: &private.ID, SubjectType: store.SubjectUser, SubjectID: users["reader"].ID, Action: store.ActionRead},
+		{ResourceType: store.ResourcePost, ResourceID: &private.ID, SubjectType: store.SubjectUser, SubjectID: users["writer"].ID, Action: store.ActionWrite},
+		{ResourceType: store.ResourcePost, SubjectType: store.SubjectRole, SubjectID: author.ID, Action: store.ActionWrite},
+	}
+	for _, entry := range entries {
+		if err := s.models.ACL.Insert(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		user   string
+		post   *store.Post
+		action string
+		want   bool
+	}{
+		{"owner", private, store.ActionWrite, true},
+		{"moderator", private, store.ActionWrite, true},
+		{"moderator", public, store.ActionWrite, true},
+		{"anonymous", public, store.ActionRead, true},
+		{"anonymous", private, store.ActionRead, false},
+		{"anonymous", public, store.ActionWrite, false},
+		{"stranger", public, store.ActionRead, true},
+		{"stranger", private, store.ActionRead, false},
+		{"stranger", public, store.ActionWrite, false},
+		{"reader", private, store.ActionRead, true},
+		{"reader", private, store.ActionWrite, false},
+		{"writer", private, store.ActionRead, true},
+		{"writer", private, store.ActionWrite, true},
+		{"writer", public, store.ActionWrite, false},
+		{"role writer", public, store.ActionWrite, true},
+		{"role writer", private, store.ActionRead, true},
+		{"role writer", ownerless, store.ActionWrite, true},
+		{"author", ownerless, store.ActionWrite, true},
+		{"author", public, store.ActionWrite, false},
+		{"stranger", ownerless, store.ActionRead, true},
+		{"stranger", ownerless, store.ActionWrite, false},
+		{"anonymous", ownerless, store.ActionWrite, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user+" "+tt.action+" "+tt.post.Title, func(t *testing.T) {
+			r := s.contextSetUser(httptest.NewRequest("GET", "/", nil), users[tt.user])
+
+			got, err := s.canAccessPost(r, tt.post, tt.action)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("canAccessPost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/api_structure/internal/config"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/realip"
+	"golang.org/x/time/rate"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// limitPolicy is the limit which applies to a request, with the key of the
+// bucket counting the requests it applies to.
+type limitPolicy struct {
+	key   string
+	limit rate.Limit
+	burst int
+}
+
+// ipLimitPolicy resolves the limit of a request by the IP address of the
+// client, as resolved through the trusted proxies. It applies to every
+// request before authentication, so requests with invalid tokens are
+// limited too. Requests carrying a token are counted in a bucket of their
+// own with the base limit of users, so the users behind an address are not
+// held to the limits of anonymous clients. The tiers only raise the limits
+// counted by user id in limitUser, once the token is validated, so invalid
+// tokens cannot claim them.
+func (s *server) ipLimitPolicy(r *http.Request, cfg *config.Config) limitPolicy {
+	rps, burst := cfg.Limiter.RPS, cfg.Limiter.Burst
+	subject := "ip:" + realip.FromContext(r.Context())
+
+	if r.Header.Get("Authorization") != "" {
+		rps, burst = cfg.Limiter.UserRPS, cfg.Limiter.UserBurst
+		subject += " token"
+	}
+
+	rps, burst, scope := routeLimit(r, cfg, rps, burst)
+
+	return limitPolicy{
+		key:   subject + " " + scope,
+		limit: rate.Limit(rps),
+		burst: burst,
+	}
+}
+
+// userLimitPolicy resolves the limit of a request by the id of the
+// authenticated user, raised by the tier of the user.
+func (s *server) userLimitPolicy(r *http.Request, cfg *config.Config, user *store.User) (limitPolicy, error) {
+	rps, burst, scope := routeLimit(r, cfg, cfg.Limiter.UserRPS, cfg.Limiter.UserBurst)
+
+	if len(cfg.Limiter.Tiers) > 0 {
+		permissions, err := s.models.Permissions.GetAllForUser(r.Context(), user.ID)
+		if err != nil {
+			return limitPolicy{}, err
+		}
+
+		multiplier := 1.0
+		for _, tier := range cfg.Limiter.Tiers {
+			if tier.Multiplier > multiplier && permissions.Include(tier.Permission) {
+				multiplier = tier.Multiplier
+			}
+		}
+
+		rps *= multiplier
+		burst = int(math.Ceil(float64(burst) * multiplier))
+	}
+
+	return limitPolicy{
+		key:   fmt.Sprintf("user:%d %s", user.ID, scope),
+		limit: rate.Limit(rps),
+		burst: burst,
+	}, nil
+}
+
+// routeLimit returns the limit configured for the route of the request, or
+// the given default limit, with the scope of the bucket counting it. Every
+// route which has its limits configured is counted in a bucket of its own.
+func routeLimit(r *http.Request, cfg *config.Config, rps float64, burst int) (float64, int, string) {
+	if route := matchRouteLimit(r, cfg.Limiter.Routes); route != nil {
+		return route.RPS, route.Burst, route.Method + " " + route.Path
+	}
+
+	return rps, burst, "*"
+}
+
+// matchRouteLimit returns the first route limit matching the route and the
+// method of the request, or nil.
+func matchRouteLimit(r *http.Request, routes []config.RouteLimit) *config.RouteLimit {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil
+	}
+
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+
+	for i := range routes {
+		if routes[i].Path == path && (routes[i].Method == "" || strings.EqualFold(routes[i].Method, r.Method)) {
+			return &routes[i]
+		}
+	}
+
+	return nil
+}
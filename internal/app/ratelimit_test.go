@@ -0,0 +1,120 @@
+package app
+
+import (
+	"github.com/nebisin/api_structure/internal/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		token       string
+		user        bool
+		permissions []string
+		addresses   []string
+		wantLimit   int
+		wantStatus  int
+		wantClient  string
+	}{
+		{name: "anonymous", wantLimit: 2, wantStatus: http.StatusOK, wantClient: "ip"},
+		{name: "invalid token", token: "ABCDEFGHIJKLMNOPQRSTUVWXYZ", wantLimit: 3, wantStatus: http.StatusUnauthorized, wantClient: "ip"},
+		{name: "user", user: true, wantLimit: 3, wantStatus: http.StatusOK, wantClient: "ip"},
+		{name: "user of a tier", user: true, permissions: []string{"metrics:read"}, wantLimit: 3, wantStatus: http.StatusOK, wantClient: "ip"},
+		{name: "user from several addresses", user: true, addresses: []string{"192.0.2.1:1234", "192.0.2.2:1234"}, wantLimit: 3, wantStatus: http.StatusOK, wantClient: "user"},
+		{name: "user of a tier from several addresses", user: true, permissions: []string{"metrics:read"}, addresses: []string{"192.0.2.1:1234", "192.0.2.2:1234"}, wantLimit: 6, wantStatus: http.StatusOK, wantClient: "ip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.Limiter.RPS, cfg.Limiter.Burst = 0.001, 2
+				cfg.Limiter.UserRPS, cfg.Limiter.UserBurst = 0.001, 3
+				cfg.Limiter.Tiers = []config.LimitTier{{Permission: "metrics:read", Multiplier: 10}}
+			})
+
+			token := tt.token
+			if tt.user {
+				_, token = newTestUser(t, s, "user", tt.permissions...)
+			}
+
+			addresses := tt.addresses
+			if addresses == nil {
+				addresses = []string{"192.0.2.1:1234"}
+			}
+
+			serve := func(i int) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodGet, "/api/v1/healthcheck", nil)
+				r.RemoteAddr = addresses[i%len(addresses)]
+				if token != "" {
+					r.Header.Set("Authorization", "Bearer "+token)
+				}
+
+				w := httptest.NewRecorder()
+				s.handler.ServeHTTP(w, r)
+
+				return w
+			}
+
+			for i := 0; i < tt.wantLimit; i++ {
+				w := serve(i)
+				if w.Code != tt.wantStatus {
+					t.Fatalf("request %d = %d, want %d", i+1, w.Code, tt.wantStatus)
+				}
+
+				if w.Header().Get("RateLimit-Remaining") == "" || w.Header().Get("RateLimit-Limit") == "" {
+					t.Errorf("request %d has no RateLimit headers", i+1)
+				}
+			}
+
+			w := serve(tt.wantLimit)
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("request over the limit = %d, want %d", w.Code, http.StatusTooManyRequests)
+			}
+
+			if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+				t.Errorf("RateLimit-Remaining = %q, want 0", got)
+			}
+
+			if w.Header().Get("Retry-After") == "" {
+				t.Error("Retry-After is not set")
+			}
+
+			for _, client := range []string{"ip", "user"} {
+				want := 0.0
+				if client == tt.wantClient {
+					want = 1
+				}
+
+				if got := testutil.ToFloat64(s.metrics.rateLimitRejections.WithLabelValues(client)); got != want {
+					t.Errorf("%s rejections = %v, want %v", client, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitFewestRemaining(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Limiter.RPS, cfg.Limiter.Burst = 0.001, 5
+		cfg.Limiter.UserRPS, cfg.Limiter.UserBurst = 0.001, 3
+		cfg.Limiter.Tiers = []config.LimitTier{{Permission: "metrics:read", Multiplier: 10}}
+	})
+
+	_, token := newTestUser(t, s, "user", "metrics:read")
+
+	for i := 1; i <= 3; i++ {
+		w := serveTestRequest(s, http.MethodGet, "/api/v1/healthcheck", token, "")
+
+		if got := w.Header().Get("RateLimit-Limit"); got != "3" {
+			t.Errorf("RateLimit-Limit = %q, want 3", got)
+		}
+
+		if got := w.Header().Get("RateLimit-Remaining"); got != strconv.Itoa(3-i) {
+			t.Errorf("RateLimit-Remaining = %q, want %d", got, 3-i)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"github.com/nebisin/api_structure/internal/config"
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// setConfig makes cfg the current configuration and applies the settings
+// which are not read on every use.
+func (s *server) setConfig(cfg *config.Config) {
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err == nil {
+		s.logger.SetLevel(level)
+	}
+
+	s.setLogFormat(cfg.LogFormat)
+
+	s.configValue.Store(cfg)
+}
+
+// watchConfig reloads the configuration on SIGHUP and, when config_watch is
+// set, whenever the modification time of the configuration file changes.
+func (s *server) watchConfig() {
+	go func() {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+
+		for range hangup {
+			s.logger.Info("reloading the configuration on SIGHUP")
+			s.reloadConfig()
+		}
+	}()
+
+	cfg := s.config()
+	if cfg.ConfigWatch <= 0 || cfg.File == "" {
+		return
+	}
+
+	go func() {
+		modTime := fileModTime(cfg.File)
+
+		for {
+			time.Sleep(cfg.ConfigWatch)
+
+			if t := fileModTime(cfg.File); !t.Equal(modTime) {
+				modTime = t
+
+				s.logger.WithField("file", cfg.File).Info("reloading the changed configuration file")
+				s.reloadConfig()
+			}
+		}
+	}()
+}
+
+// reloadConfig loads the configuration again and applies its reloadable
+// settings. An invalid configuration, or one whose IP rules cannot be
+// loaded, is rejected as a whole and the current one stays in effect. The
+// reloads run one at a time, as SIGHUP and the file watcher may trigger
+// them concurrently.
+func (s *server) reloadConfig() {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	next, err := config.Load(os.Args[1:])
+	if err != nil {
+		s.logger.WithError(err).Error("the reloaded configuration is invalid, keeping the current one")
+		return
+	}
+
+	cfg, ignored := s.config().WithReloadable(next)
+	if len(ignored) > 0 {
+		s.logger.WithField("settings", ignored).Warn("the changes of these settings require a restart")
+	}
+
+	filter, err := s.loadIPFilter(context.Background(), cfg)
+	if err != nil {
+		s.logger.WithError(err).Error("an error occurred while loading the reloaded ip rules, keeping the current configuration")
+		return
+	}
+
+	s.setConfig(cfg)
+	s.ipFilter.Store(filter)
+
+	s.logger.Info("reloaded the configuration")
+}
+
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"expvar"
 	"github.com/gorilla/mux"
 	"github.com/nebisin/api_structure/pkg/response"
 	"net/http"
@@ -11,37 +12,91 @@ func (s *server) routes() {
 
 	s.router = mux.NewRouter()
 
+	s.router.Use(s.instrument)
+	s.router.Use(s.traceRequest)
 	s.router.Use(s.recoverPanic)
+	s.router.Use(s.resolveClientIP)
+	s.router.Use(s.filterIP)
 	s.router.Use(s.enableCORS)
-	s.router.Use(s.rateLimit)
+	s.router.Use(s.limitIP)
 	s.router.Use(s.authenticate)
+	s.router.Use(s.limitUser)
+	s.router.Use(s.auditImpersonation)
 
-	s.router.NotFoundHandler = http.HandlerFunc(response.NotFoundResponse)
-	s.router.MethodNotAllowedHandler = http.HandlerFunc(response.MethodNotAllowedResponse)
+	s.router.NotFoundHandler = s.instrument(s.traceRequest(http.HandlerFunc(response.NotFoundResponse)))
+	s.router.MethodNotAllowedHandler = s.instrument(s.traceRequest(http.HandlerFunc(response.MethodNotAllowedResponse)))
 
 	s.router.Methods("OPTIONS")
 
+	if s.config().Metrics.Enabled {
+		s.router.HandleFunc("/metrics", s.requirePermission("metrics:read", s.metrics.handler().ServeHTTP)).Methods(http.MethodGet)
+	}
+
 	apiV1 := s.router.PathPrefix("/api/v1").Subrouter()
 
 	apiV1.HandleFunc("/healthcheck", s.handleHealthCheck)
+	apiV1.HandleFunc("/debug/vars", s.requirePermission("metrics:read", expvar.Handler().ServeHTTP)).Methods(http.MethodGet)
 
 	apiV1.HandleFunc("/posts", s.requirePermission("posts:write", s.handleCreatePost)).Methods(http.MethodPost)
 	apiV1.HandleFunc("/posts/{id}", s.requirePermission("posts:read", s.handleShowPost)).Methods(http.MethodGet)
 	apiV1.HandleFunc("/posts", s.requirePermission("posts:read", s.handleListPosts)).Methods(http.MethodGet)
-	apiV1.HandleFunc("/posts/{id}", s.requirePermission("posts:write", s.handleUpdatePost)).Methods(http.MethodPatch)
-	apiV1.HandleFunc("/posts/{id}", s.requirePermission("posts:write", s.handleDeletePost)).Methods(http.MethodDelete)
+	apiV1.HandleFunc("/posts/{id}", s.requireAuthenticatedUser(s.handleUpdatePost)).Methods(http.MethodPatch)
+	apiV1.HandleFunc("/posts/{id}", s.requireAuthenticatedUser(s.handleDeletePost)).Methods(http.MethodDelete)
 
 	apiV1.HandleFunc("/users", s.handleRegisterUser).Methods(http.MethodPost)
 	apiV1.HandleFunc("/users/activated", s.handleActivateUser).Methods(http.MethodPut)
 
+	apiV1.HandleFunc("/users/{id}/permissions", s.requirePermission("permissions:read", s.handleShowUserPermissions)).Methods(http.MethodGet)
+	apiV1.HandleFunc("/users/{id}/permissions", s.requirePermission("permissions:write", s.handleGrantUserPermissions)).Methods(http.MethodPost)
+	apiV1.HandleFunc("/users/{id}/permissions/{code}", s.requirePermission("permissions:write", s.handleRevokeUserPermission)).Methods(http.MethodDelete)
+
+	apiV1.HandleFunc("/permissions", s.requirePermission("permissions:read", s.handleListPermissions)).Methods(http.MethodGet)
+	apiV1.HandleFunc("/permissions", s.requirePermission("permissions:write", s.handleCreatePermission)).Methods(http.MethodPost)
+
+	apiV1.HandleFunc("/users/{id}/impersonation", s.requirePermission("users:impersonate", s.handleImpersonateUser)).Methods(http.MethodPost)
+
+	apiV1.HandleFunc("/users/{id}/roles", s.requirePermission("permissions:read", s.handleShowUserRoles)).Methods(http.MethodGet)
+	apiV1.HandleFunc("/users/{id}/roles", s.requirePermission("permissions:write", s.handleAssignUserRoles)).Methods(http.MethodPost)
+	apiV1.HandleFunc("/users/{id}/roles/{role}", s.requirePermission("permissions:write", s.handleUnassignUserRole)).Methods(http.MethodDelete)
+
+	apiV1.HandleFunc("/roles", s.requirePermission("permissions:read", s.handleListRoles)).Methods(http.MethodGet)
+	apiV1.HandleFunc("/roles", s.requirePermission("permissions:write", s.handleCreateRole)).Methods(http.MethodPost)
+	apiV1.HandleFunc("/roles/{name}/permissions", s.requirePermission("permissions:write", s.handleAddRolePermissions)).Methods(http.MethodPost)
+	apiV1.HandleFunc("/roles/{name}/permissions/{code}", s.requirePermission("permissions:write", s.handleRemoveRolePermission)).Methods(http.MethodDelete)
+
+	apiV1.HandleFunc("/invitations", s.requirePermission("invitations:read", s.handleListInvitations)).Methods(http.MethodGet)
+	apiV1.HandleFunc("/invitations", s.requirePermission("invitations:write", s.handleCreateInvitation)).Methods(http.MethodPost)
+	apiV1.HandleFunc("/invitations/{id}", s.requirePermission("invitations:write", s.handleDeleteInvitation)).Methods(http.MethodDelete)
+
+	apiV1.HandleFunc("/acl", s.requirePermission("permissions:read", s.handleListACLEntries)).Methods(http.MethodGet)
+	apiV1.HandleFunc("/acl", s.requirePermission("permissions:write", s.handleCreateACLEntry)).Methods(http.MethodPost)
+	apiV1.HandleFunc("/acl/{id}", s.requirePermission("permissions:write", s.handleDeleteACLEntry)).Methods(http.MethodDelete)
+
+	apiV1.HandleFunc("/ip-rules", s.requirePermission("ip_rules:read", s.handleListIPRules)).Methods(http.MethodGet)
+	apiV1.HandleFunc("/ip-rules", s.requirePermission("ip_rules:write", s.handleCreateIPRule)).Methods(http.MethodPost)
+	apiV1.HandleFunc("/ip-rules/{id}", s.requirePermission("ip_rules:write", s.handleDeleteIPRule)).Methods(http.MethodDelete)
+
+	apiV1.HandleFunc("/outbox", s.requirePermission("outbox:read", s.handleListOutbox)).Methods(http.MethodGet)
+	apiV1.HandleFunc("/outbox/{id}", s.requirePermission("outbox:read", s.handleShowOutboxMessage)).Methods(http.MethodGet)
+	apiV1.HandleFunc("/outbox/{id}/redrive", s.requirePermission("outbox:write", s.handleRedriveOutboxMessage)).Methods(http.MethodPost)
+
 	apiV1.HandleFunc("/tokens/authentication", s.handleCreateAuthenticationToken).Methods(http.MethodPost)
+	apiV1.HandleFunc("/tokens/authentication", s.requireAuthenticatedUser(s.handleRevokeAuthenticationTokens)).Methods(http.MethodDelete)
+
+	apiV1.HandleFunc("/audit-events", s.requirePermission("audit:read", s.handleListAuditEvents)).Methods(http.MethodGet)
+
+	health := mux.NewRouter()
+	health.HandleFunc("/livez", s.handleLivez).Methods(http.MethodGet)
+	health.HandleFunc("/readyz", s.handleReadyz).Methods(http.MethodGet)
+	health.PathPrefix("/").Handler(s.router)
 
+	s.handler = health
 }
 
 func (s *server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	err := response.JSONResponse(w, http.StatusOK, response.Envelope{
 		"status":      "available",
-		"environment": s.config.env,
+		"environment": s.config().Env,
 		"version":     version,
 	})
 	if err != nil {
@@ -3,20 +3,30 @@ package app
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 func (s *server) serve() error {
+	// The request contexts derive from baseCtx, so canceling it aborts
+	// the queries of the requests still running when shutdown times out.
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
 	srv := &http.Server{
-		Addr:         s.config.port,
-		Handler:      s.router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  time.Minute,
+		Addr:         s.config().Port,
+		Handler:      s.assignRequestID(s.logAccess(s.handler)),
+		ReadTimeout:  s.config().HTTP.ReadTimeout,
+		WriteTimeout: s.config().HTTP.WriteTimeout,
+		IdleTimeout:  s.config().HTTP.IdleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
 	}
 
 	shutdownError := make(chan error)
@@ -28,18 +38,18 @@ func (s *server) serve() error {
 
 		s.logger.WithField("signal", sign.String()).Info("shutting down the server")
 
-		ctx,cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		err := srv.Shutdown(ctx)
-		if err != nil {
-			shutdownError <- err
+		atomic.StoreInt32(&s.draining, 1)
+		if delay := s.config().Health.DrainDelay; delay > 0 {
+			s.logger.WithField("delay", delay.String()).Info("draining the connections")
+			time.Sleep(delay)
 		}
 
-		s.logger.WithField("addr", srv.Addr).Info("completing background tasks")
+		ctx,cancel := context.WithTimeout(context.Background(), s.config().HTTP.ShutdownTimeout)
+		defer cancel()
 
-		s.wg.Wait()
-		shutdownError <- nil
+		err := srv.Shutdown(ctx)
+		cancelBase()
+		shutdownError <- err
 	}()
 
 	s.logger.WithField("addr", srv.Addr).Info("starting the server")
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"github.com/nebisin/api_structure/internal/config"
+	"github.com/nebisin/api_structure/internal/mailer"
+	"github.com/nebisin/api_structure/internal/ratelimit"
+	"github.com/nebisin/api_structure/internal/store"
+	"github.com/nebisin/api_structure/pkg/realip"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a server on the in-memory store with its routes,
+// after applying change to the default configuration.
+func newTestServer(t *testing.T, change func(cfg *config.Config)) *server {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cfg := config.Default()
+	cfg.Store = "memory"
+	cfg.Mailer.Backend = "memory"
+	cfg.SMTP.Sender = "API <no-reply@example.com>"
+	if change != nil {
+		change(cfg)
+	}
+
+	resolver, err := realip.NewResolver(cfg.Proxies.Trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{
+		logger:     logger,
+		limiter:    ratelimit.NewMemory(),
+		realIP:     resolver,
+		metrics:    newMetrics(),
+		mailer:     mailer.New(mailer.NewMemory(), cfg.SMTP.Sender),
+		outboxWake: make(chan struct{}, 1),
+		models:     store.NewMemoryModels(nil),
+	}
+	s.configValue.Store(cfg)
+
+	if err := s.refreshIPFilter(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	s.routes()
+
+	return s
+}
+
+// newTestUser inserts an activated user with the given permissions and
+// returns it with an authentication token.
+func newTestUser(t *testing.T, s *server, name string, permissions ...string) (*store.User, string) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	user := &store.User{Name: name, Email: name + "@example.com", Activated: true}
+	if err := s.models.Users.Insert(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(permissions) > 0 {
+		if err := s.models.Permissions.AddForUser(ctx, user.ID, permissions...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, err := s.models.Tokens.New(ctx, user.ID, time.Hour, store.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user, token.Plaintext
+}
+
+// serveTestRequest serves a request with the given token and JSON body,
+// both optional, and returns the recorded response.
+func serveTestRequest(s *server, method, target, token, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	r := httptest.NewRequest(method, target, reader)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+
+	return w
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/api_structure/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/nebisin/api_structure/internal/app")
+
+// setupTracing installs the tracer provider of the configured exporter.
+// The returned function flushes the pending spans.
+func (s *server) setupTracing() func() {
+	cfg := s.config().Tracing
+
+	shutdown, err := tracing.Setup(tracing.Options{
+		ServiceName:    "api",
+		ServiceVersion: version,
+		Exporter:       cfg.Exporter,
+		Endpoint:       cfg.Endpoint,
+		SampleRatio:    cfg.SampleRatio,
+	})
+	if err != nil {
+		s.logger.WithError(err).Fatal("an error occurred while setting up the tracing")
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdown(ctx); err != nil {
+			s.logger.WithError(err).Error("an error occurred while flushing the traces")
+		}
+	}
+}
+
+// traceRequest records a span for every request, continuing the trace of
+// the W3C traceparent header of the request when there is one.
+func (s *server) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracer.Start(ctx, fmt.Sprintf("%s %s", r.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				semconv.ClientAddress(s.realIP.ClientIP(r)),
+			),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTraceRequest(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	s := newTestServer(t, nil)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/posts/12", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+
+	var span sdktrace.ReadOnlySpan
+	for _, ended := range recorder.Ended() {
+		if ended.Name() == "GET /api/v1/posts/{id}" {
+			span = ended
+		}
+	}
+
+	if span == nil {
+		t.Fatalf("no span for the route, got %d spans", len(recorder.Ended()))
+	}
+
+	if got := span.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace id = %s, want the one of the traceparent header %s", got, traceID)
+	}
+
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, attr := range span.Attributes() {
+		attributes[attr.Key] = attr.Value
+	}
+
+	if got := attributes["http.route"].AsString(); got != "/api/v1/posts/{id}" {
+		t.Errorf("http.route = %q, want %q", got, "/api/v1/posts/{id}")
+	}
+
+	if got := attributes["http.response.status_code"].AsInt64(); got != int64(w.Code) {
+		t.Errorf("http.response.status_code = %d, want %d", got, w.Code)
+	}
+
+	if span.Status().Code == codes.Error {
+		t.Errorf("status = %v, want no error for a %d response", span.Status(), w.Code)
+	}
+}
@@ -0,0 +1,215 @@
+// Package config loads the configuration of the server.
+//
+// Every setting is resolved with the following precedence, a later source
+// overriding an earlier one:
+//
+//  1. the defaults returned by Default,
+//  2. the YAML file given with the -config flag or the CONFIG_FILE variable,
+//  3. the environment variables, which may also be set in a .env file,
+//  4. the command line flags.
+//
+// The YAML key, the environment variable and the flag of a setting are
+// declared by the yaml, env and flag tags of the Config fields; the settings
+// without env and flag tags can only be set in the file. The settings
+// tagged with reload:"true", directly or through their section, can be
+// changed without restarting the server, see WithReloadable; a setting of
+// such a section tagged with reload:"false" cannot. The environment is read
+// once per process, so a reload only picks up the changes of the file.
+package config
+
+import (
+	"github.com/nebisin/api_structure/internal/store"
+	"time"
+)
+
+type Config struct {
+	// File is the path of the configuration file, if any.
+	File string `yaml:"-"`
+
+	Port  string `yaml:"port" env:"PORT" flag:"port" usage:"API server port" validate:"required"`
+	Env   string `yaml:"env" env:"APP_ENV" flag:"env" usage:"Environment (development|staging|production)" validate:"oneof=development staging production"`
+	Store string `yaml:"store" env:"APP_STORE" flag:"store" usage:"Storage backend (postgres|memory)" validate:"oneof=postgres memory"`
+
+	LogLevel    string        `yaml:"log_level" env:"LOG_LEVEL" flag:"log-level" usage:"Log level (debug|info|warn|error)" validate:"oneof=debug info warn error" reload:"true"`
+	LogFormat   string        `yaml:"log_format" env:"LOG_FORMAT" flag:"log-format" usage:"Log format (text|json)" validate:"oneof=text json" reload:"true"`
+	AccessLog   bool          `yaml:"access_log" env:"ACCESS_LOG" flag:"access-log" usage:"Log every request at the info level" reload:"true"`
+	ConfigWatch time.Duration `yaml:"config_watch" env:"CONFIG_WATCH" flag:"config-watch" usage:"Interval of checking the configuration file for changes (0 disables it)" validate:"gte=0"`
+
+	HTTP struct {
+		ReadTimeout     time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" flag:"http-read-timeout" usage:"Timeout for reading a request" validate:"gt=0"`
+		WriteTimeout    time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" flag:"http-write-timeout" usage:"Timeout for writing a response" validate:"gt=0"`
+		IdleTimeout     time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" flag:"http-idle-timeout" usage:"Timeout of idle keep-alive connections" validate:"gt=0"`
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" flag:"http-shutdown-timeout" usage:"Grace period for in-flight requests on shutdown" validate:"gt=0"`
+	} `yaml:"http"`
+
+	DB struct {
+		DSN          string        `yaml:"dsn" env:"DB_URI" flag:"db-dsn" usage:"PostgreSQL DSN" secret:"true"`
+		AutoMigrate  bool          `yaml:"auto_migrate" env:"DB_AUTOMIGRATE" flag:"db-automigrate" usage:"Apply the pending migrations on start"`
+		ReadTimeout  time.Duration `yaml:"read_timeout" env:"DB_READ_TIMEOUT" flag:"db-read-timeout" usage:"Timeout of a single read query (0 disables it)" validate:"gte=0"`
+		WriteTimeout time.Duration `yaml:"write_timeout" env:"DB_WRITE_TIMEOUT" flag:"db-write-timeout" usage:"Timeout of a single write query (0 disables it)" validate:"gte=0"`
+	} `yaml:"db"`
+
+	Mailer struct {
+		Backend string `yaml:"backend" env:"MAILER_BACKEND" flag:"mailer-backend" usage:"Mail backend (smtp|file|log|memory)" validate:"oneof=smtp file log memory"`
+		Dir     string `yaml:"dir" env:"MAILER_DIR" flag:"mailer-dir" usage:"Maildir the file backend writes to" validate:"required"`
+	} `yaml:"mailer"`
+
+	SMTP struct {
+		Host     string `yaml:"host" env:"SMTP_HOST" flag:"smtp-host" usage:"SMTP host"`
+		Port     int    `yaml:"port" env:"SMTP_PORT" flag:"smtp-port" usage:"SMTP port" validate:"gt=0,lte=65535"`
+		Username string `yaml:"username" env:"SMTP_USERNAME" flag:"smtp-username" usage:"SMTP username"`
+		Password string `yaml:"password" env:"SMTP_PASSWORD" flag:"smtp-password" usage:"SMTP password" secret:"true"`
+		Sender   string `yaml:"sender" env:"SMTP_SENDER" flag:"smtp-sender" usage:"SMTP sender" validate:"required"`
+	} `yaml:"smtp"`
+
+	Outbox struct {
+		Workers        int           `yaml:"workers" env:"OUTBOX_WORKERS" flag:"outbox-workers" usage:"Number of workers sending the emails of the outbox" validate:"gt=0" reload:"false"`
+		PollInterval   time.Duration `yaml:"poll_interval" env:"OUTBOX_POLL_INTERVAL" flag:"outbox-poll-interval" usage:"Interval of checking the outbox for due emails" validate:"gt=0"`
+		MaxAttempts    int           `yaml:"max_attempts" env:"OUTBOX_MAX_ATTEMPTS" flag:"outbox-max-attempts" usage:"Attempts to send an email before it is dead-lettered" validate:"gt=0"`
+		InitialBackoff time.Duration `yaml:"initial_backoff" env:"OUTBOX_INITIAL_BACKOFF" flag:"outbox-initial-backoff" usage:"Delay before the second attempt, doubled for every next one" validate:"gt=0"`
+		MaxBackoff     time.Duration `yaml:"max_backoff" env:"OUTBOX_MAX_BACKOFF" flag:"outbox-max-backoff" usage:"Maximum delay between two attempts" validate:"gtefield=InitialBackoff"`
+		Lease          time.Duration `yaml:"lease" env:"OUTBOX_LEASE" flag:"outbox-lease" usage:"Delay before retrying an email whose worker stopped while sending it" validate:"gt=0"`
+		Retention      time.Duration `yaml:"retention" env:"OUTBOX_RETENTION" flag:"outbox-retention" usage:"How long the sent emails are kept in the outbox" validate:"gt=0"`
+	} `yaml:"outbox" reload:"true"`
+
+	Proxies struct {
+		Trusted []string `yaml:"trusted" env:"TRUSTED_PROXIES" flag:"trusted-proxies" usage:"CIDRs or addresses of the proxies trusted to forward the client IP address (space separated)" validate:"dive,cidr|ip"`
+	} `yaml:"proxies"`
+
+	IPFilter struct {
+		Rules           []IPFilterRule `yaml:"rules" validate:"dive"`
+		RefreshInterval time.Duration  `yaml:"refresh_interval" env:"IP_FILTER_REFRESH_INTERVAL" flag:"ip-filter-refresh-interval" usage:"Interval of reloading the IP rules managed through the API" validate:"gt=0" reload:"false"`
+	} `yaml:"ip_filter" reload:"true"`
+
+	CORS struct {
+		TrustedOrigins []string `yaml:"trusted_origins" env:"CORS_TRUSTED_ORIGINS" flag:"cors-trusted-origins" usage:"Trusted CORS origins (space separated)"`
+	} `yaml:"cors" reload:"true"`
+
+	Limiter struct {
+		Enabled   bool         `yaml:"enabled" env:"LIMITER_ENABLED" flag:"limiter-enabled" usage:"Enable the rate limiter"`
+		Backend   string       `yaml:"backend" env:"LIMITER_BACKEND" flag:"limiter-backend" usage:"Rate limiter backend (memory|postgres), postgres shares the limits between instances" validate:"oneof=memory postgres" reload:"false"`
+		RPS       float64      `yaml:"rps" env:"LIMITER_RPS" flag:"limiter-rps" usage:"Requests per second allowed for an anonymous client, counted by IP address" validate:"gt=0"`
+		Burst     int          `yaml:"burst" env:"LIMITER_BURST" flag:"limiter-burst" usage:"Maximum burst of requests of an anonymous client" validate:"gt=0"`
+		UserRPS   float64      `yaml:"user_rps" env:"LIMITER_USER_RPS" flag:"limiter-user-rps" usage:"Requests per second allowed for an authenticated user" validate:"gt=0"`
+		UserBurst int          `yaml:"user_burst" env:"LIMITER_USER_BURST" flag:"limiter-user-burst" usage:"Maximum burst of requests of an authenticated user" validate:"gt=0"`
+		Routes    []RouteLimit `yaml:"routes" validate:"dive"`
+		Tiers     []LimitTier  `yaml:"tiers" validate:"dive"`
+	} `yaml:"limiter" reload:"true"`
+
+	Registration struct {
+		DefaultRole string `yaml:"default_role" env:"REGISTRATION_DEFAULT_ROLE" flag:"registration-default-role" usage:"Role assigned to newly registered users" validate:"required"`
+		InviteOnly  bool   `yaml:"invite_only" env:"REGISTRATION_INVITE_ONLY" flag:"registration-invite-only" usage:"Allow registration only with an invitation token"`
+	} `yaml:"registration"`
+
+	Tokens struct {
+		ActivationTTL     time.Duration `yaml:"activation_ttl" env:"ACTIVATION_TOKEN_TTL" flag:"activation-token-ttl" usage:"Lifetime of activation tokens" validate:"gt=0"`
+		AuthenticationTTL time.Duration `yaml:"authentication_ttl" env:"AUTHENTICATION_TOKEN_TTL" flag:"authentication-token-ttl" usage:"Lifetime of authentication tokens" validate:"gt=0"`
+		ImpersonationTTL  time.Duration `yaml:"impersonation_ttl" env:"IMPERSONATION_TTL" flag:"impersonation-ttl" usage:"Lifetime of impersonation tokens" validate:"gt=0"`
+		InvitationTTL     time.Duration `yaml:"invitation_ttl" env:"INVITATION_TTL" flag:"invitation-ttl" usage:"Lifetime of invitations" validate:"gt=0"`
+	} `yaml:"tokens"`
+
+	Health struct {
+		Timeout    time.Duration `yaml:"timeout" env:"HEALTH_TIMEOUT" flag:"health-timeout" usage:"Timeout of the readiness checks" validate:"gt=0"`
+		CheckSMTP  bool          `yaml:"check_smtp" env:"HEALTH_CHECK_SMTP" flag:"health-check-smtp" usage:"Check the connectivity of the SMTP server for readiness"`
+		DrainDelay time.Duration `yaml:"drain_delay" env:"HEALTH_DRAIN_DELAY" flag:"health-drain-delay" usage:"Time the server keeps serving while reporting not ready before shutting down" validate:"gte=0"`
+	} `yaml:"health" reload:"true"`
+
+	Metrics struct {
+		Enabled bool `yaml:"enabled" env:"METRICS_ENABLED" flag:"metrics-enabled" usage:"Expose the Prometheus metrics on /metrics to the users having metrics:read"`
+	} `yaml:"metrics"`
+
+	Tracing struct {
+		Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter" usage:"Trace exporter (none|stdout|otlp)" validate:"oneof=none stdout otlp"`
+		Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT" flag:"tracing-endpoint" usage:"OTLP/HTTP traces endpoint of the collector" validate:"url"`
+		SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio" usage:"Ratio of the traces started by the server which are sampled" validate:"gte=0,lte=1"`
+	} `yaml:"tracing"`
+
+	Permissions struct {
+		CacheTTL time.Duration `yaml:"cache_ttl" env:"PERMISSIONS_CACHE_TTL" flag:"permissions-cache-ttl" usage:"Permission cache TTL (0 disables the cache)" validate:"gte=0"`
+	} `yaml:"permissions"`
+}
+
+// IPFilterRule allows or denies the networks, given as CIDRs or single IP
+// addresses, to the routes under a path prefix.
+type IPFilterRule struct {
+	PathPrefix string   `yaml:"path_prefix" validate:"required,startswith=/"`
+	Allow      []string `yaml:"allow" validate:"dive,cidr|ip"`
+	Deny       []string `yaml:"deny" validate:"dive,cidr|ip"`
+}
+
+// RouteLimit replaces the default limits for the requests of a route.
+type RouteLimit struct {
+	// Method is the request method, every method matches when empty.
+	Method string `yaml:"method"`
+	// Path is the path template of the route, as in /api/v1/posts/{id}.
+	Path  string  `yaml:"path" validate:"required"`
+	RPS   float64 `yaml:"rps" validate:"gt=0"`
+	Burst int     `yaml:"burst" validate:"gt=0"`
+}
+
+// LimitTier multiplies the limits of the users having a permission. The
+// highest multiplier of the tiers of a user applies.
+type LimitTier struct {
+	Permission string  `yaml:"permission" validate:"required"`
+	Multiplier float64 `yaml:"multiplier" validate:"gt=0"`
+}
+
+// Default returns the configuration used when no source sets a value.
+func Default() *Config {
+	cfg := &Config{
+		Env:       "development",
+		Store:     "postgres",
+		LogLevel:  "info",
+		LogFormat: "text",
+		AccessLog: true,
+	}
+
+	cfg.HTTP.ReadTimeout = 10 * time.Second
+	cfg.HTTP.WriteTimeout = 30 * time.Second
+	cfg.HTTP.IdleTimeout = time.Minute
+	cfg.HTTP.ShutdownTimeout = 5 * time.Second
+
+	cfg.DB.ReadTimeout = store.DefaultTimeouts.Read
+	cfg.DB.WriteTimeout = store.DefaultTimeouts.Write
+
+	cfg.Mailer.Backend = "smtp"
+	cfg.Mailer.Dir = "mail"
+
+	cfg.SMTP.Port = 2525
+
+	cfg.Outbox.Workers = 2
+	cfg.Outbox.PollInterval = time.Second
+	cfg.Outbox.MaxAttempts = 10
+	cfg.Outbox.InitialBackoff = 30 * time.Second
+	cfg.Outbox.MaxBackoff = time.Hour
+	cfg.Outbox.Lease = 5 * time.Minute
+	cfg.Outbox.Retention = 7 * 24 * time.Hour
+
+	cfg.IPFilter.RefreshInterval = 30 * time.Second
+
+	cfg.Limiter.Enabled = true
+	cfg.Limiter.Backend = "memory"
+	cfg.Limiter.RPS = 2
+	cfg.Limiter.Burst = 4
+	cfg.Limiter.UserRPS = 4
+	cfg.Limiter.UserBurst = 8
+
+	cfg.Registration.DefaultRole = "reader"
+
+	cfg.Tokens.ActivationTTL = 3 * 24 * time.Hour
+	cfg.Tokens.AuthenticationTTL = 24 * time.Hour
+	cfg.Tokens.ImpersonationTTL = 15 * time.Minute
+	cfg.Tokens.InvitationTTL = 7 * 24 * time.Hour
+
+	cfg.Health.Timeout = 2 * time.Second
+
+	cfg.Metrics.Enabled = true
+
+	cfg.Tracing.Exporter = "none"
+	cfg.Tracing.Endpoint = "http://localhost:4318/v1/traces"
+	cfg.Tracing.SampleRatio = 1
+
+	cfg.Permissions.CacheTTL = time.Minute
+
+	return cfg
+}
@@ -0,0 +1,347 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/joho/godotenv"
+	"github.com/nebisin/api_structure/pkg/request"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redacted replaces the values of the secret settings in Redacted.
+const redacted = "REDACTED"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Errors lists every problem found while loading a configuration.
+type Errors []string
+
+func (e Errors) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// setting is a leaf field of Config with its tags.
+type setting struct {
+	path   string
+	env    string
+	flag   string
+	usage  string
+	secret bool
+	reload bool
+	value  reflect.Value
+}
+
+// Load resolves the configuration from the sources described in the package
+// documentation, with the command line flags taken from args. When Errors
+// is returned, the configuration is still returned so it can be reported.
+func Load(args []string) (*Config, error) {
+	cfg, errs := resolve(args)
+
+	errs = append(errs, cfg.Validate()...)
+
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+
+	return cfg, nil
+}
+
+// Parse resolves the configuration like Load but does not validate it, for
+// the commands which only use some of the settings and validate them.
+func Parse(args []string) (*Config, error) {
+	cfg, errs := resolve(args)
+
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+
+	return cfg, nil
+}
+
+func resolve(args []string) (*Config, Errors) {
+	var errs Errors
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, fmt.Sprintf(".env: %v", err))
+	}
+
+	cfg := Default()
+	settings := cfg.settings()
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	file := flags.String("config", os.Getenv("CONFIG_FILE"), "Path of the YAML configuration file (env CONFIG_FILE)")
+
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+
+		flags.Var(&flagValue{setting: s}, s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+
+	flags.Parse(args)
+
+	if *file != "" {
+		cfg.File = *file
+		errs = append(errs, cfg.loadFile(*file)...)
+	}
+
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+
+		if raw, found := os.LookupEnv(s.env); found {
+			if err := set(s.value, raw); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", s.env, err))
+			}
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if v, ok := f.Value.(*flagValue); ok && v.raw != nil {
+			set(v.setting.value, *v.raw)
+		}
+	})
+
+	return cfg, errs
+}
+
+// Validate reports every invalid setting, named after its YAML path.
+func (c *Config) Validate() Errors {
+	var errs Errors
+
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.Split(field.Tag.Get("yaml"), ",")[0]
+	})
+
+	if err := validate.Struct(c); err != nil {
+		var fieldErrors validator.ValidationErrors
+		if !errors.As(err, &fieldErrors) {
+			return Errors{err.Error()}
+		}
+
+		for _, fieldError := range fieldErrors {
+			path := strings.SplitN(fieldError.Namespace(), ".", 2)[1]
+			errs = append(errs, fmt.Sprintf("%s: %s", path, request.ValidationMessage(fieldError)))
+		}
+	}
+
+	if c.Store == "postgres" && c.DB.DSN == "" {
+		errs = append(errs, "db.dsn: must be provided when the store is postgres")
+	}
+
+	if c.Mailer.Backend == "smtp" && c.SMTP.Host == "" {
+		errs = append(errs, "smtp.host: must be provided when the mailer backend is smtp")
+	}
+
+	if c.Limiter.Backend == "postgres" && c.Store != "postgres" {
+		errs = append(errs, "limiter.backend: must be memory when the store is not postgres")
+	}
+
+	return errs
+}
+
+// WithReloadable returns a copy of the configuration with the reloadable
+// settings taken from next, and the paths of the other settings which
+// differ in next and can only be changed by a restart.
+func (c *Config) WithReloadable(next *Config) (*Config, []string) {
+	merged := *c
+
+	var ignored []string
+
+	current, updated := merged.settings(), next.settings()
+
+	for i := range current {
+		if reflect.DeepEqual(current[i].value.Interface(), updated[i].value.Interface()) {
+			continue
+		}
+
+		if !current[i].reload {
+			ignored = append(ignored, current[i].path)
+			continue
+		}
+
+		current[i].value.Set(updated[i].value)
+	}
+
+	return &merged, ignored
+}
+
+// Redacted returns a copy of the configuration with the secrets replaced.
+func (c *Config) Redacted() *Config {
+	r := *c
+
+	for _, s := range r.settings() {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString(redacted)
+		}
+	}
+
+	return &r
+}
+
+// WriteYAML writes the configuration in the format of the configuration file.
+func (c *Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+func (c *Config) loadFile(path string) Errors {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Errors{fmt.Sprintf("config file: %v", err)}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		var typeError *yaml.TypeError
+		if errors.As(err, &typeError) {
+			var errs Errors
+			for _, e := range typeError.Errors {
+				errs = append(errs, fmt.Sprintf("%s: %s", path, e))
+			}
+			return errs
+		}
+
+		return Errors{fmt.Sprintf("%s: %v", path, err)}
+	}
+
+	return nil
+}
+
+// settings returns the leaf fields of the configuration in declaration order.
+func (c *Config) settings() []setting {
+	return collectSettings(reflect.ValueOf(c).Elem(), "", false)
+}
+
+func collectSettings(v reflect.Value, prefix string, reload bool) []setting {
+	var settings []setting
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		path := prefix + field.Tag.Get("yaml")
+
+		if field.Tag.Get("yaml") == "-" {
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			settings = append(settings, collectSettings(v.Field(i), path+".", reload || field.Tag.Get("reload") == "true")...)
+			continue
+		}
+
+		settings = append(settings, setting{
+			path:   path,
+			env:    field.Tag.Get("env"),
+			flag:   field.Tag.Get("flag"),
+			usage:  field.Tag.Get("usage"),
+			secret: field.Tag.Get("secret") == "true",
+			reload: field.Tag.Get("reload") == "true" || reload && field.Tag.Get("reload") != "false",
+			value:  v.Field(i),
+		})
+	}
+
+	return settings
+}
+
+// set parses raw into v according to the type of v.
+func set(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(strings.Fields(raw)))
+
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+
+	return nil
+}
+
+// flagValue records the raw value of a flag, which is applied only after
+// the configuration file and the environment variables.
+type flagValue struct {
+	setting setting
+	raw     *string
+}
+
+func (f *flagValue) String() string {
+	if f == nil || !f.setting.value.IsValid() {
+		return ""
+	}
+
+	v := f.setting.value
+
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String()
+	case v.Kind() == reflect.Slice:
+		return strings.Join(v.Interface().([]string), " ")
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+func (f *flagValue) Set(raw string) error {
+	// Parse into a scratch value to report syntax errors right away.
+	if err := set(reflect.New(f.setting.value.Type()).Elem(), raw); err != nil {
+		return err
+	}
+
+	f.raw = &raw
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.setting.value.Kind() == reflect.Bool
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setenv sets an environment variable for the duration of the test, or
+// unsets it when value is nil.
+func setenv(t *testing.T, key string, value *string) {
+	previous, found := os.LookupEnv(key)
+
+	if value != nil {
+		os.Setenv(key, *value)
+	} else {
+		os.Unsetenv(key)
+	}
+
+	t.Cleanup(func() {
+		if found {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	const file = `port: ":4000"
+store: memory
+smtp:
+  host: localhost
+  sender: API <no-reply@example.com>
+limiter:
+  rps: 3
+`
+
+	tests := []struct {
+		name      string
+		file      string
+		env       map[string]string
+		args      []string
+		wantRPS   float64
+		wantPort  string
+		wantError string
+	}{
+		{name: "file", file: file, wantRPS: 3, wantPort: ":4000"},
+		{name: "env overrides file", file: file, env: map[string]string{"LIMITER_RPS": "5", "PORT": ":5000"}, wantRPS: 5, wantPort: ":5000"},
+		{name: "flag overrides env", file: file, env: map[string]string{"LIMITER_RPS": "5"}, args: []string{"-limiter-rps", "7"}, wantRPS: 7, wantPort: ":4000"},
+		{name: "defaults", args: []string{"-port", ":4000", "-store", "memory", "-smtp-host", "localhost", "-smtp-sender", "a@example.com"}, wantRPS: 2, wantPort: ":4000"},
+		{name: "missing setting", args: []string{"-store", "memory", "-smtp-host", "localhost", "-smtp-sender", "a@example.com"}, wantError: "port:"},
+		{name: "invalid setting", file: file, env: map[string]string{"APP_STORE": "mysql"}, wantError: "store:"},
+		{name: "invalid env value", file: file, env: map[string]string{"LIMITER_RPS": "fast"}, wantError: "LIMITER_RPS:"},
+		{name: "dsn required by postgres", file: file, args: []string{"-store", "postgres"}, wantError: "db.dsn:"},
+		{name: "unknown key", file: file + "unknown: true\n", wantError: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"CONFIG_FILE", "PORT", "APP_STORE", "LIMITER_RPS", "SMTP_HOST", "SMTP_SENDER", "DB_URI"} {
+				setenv(t, key, nil)
+			}
+
+			for key, value := range tt.env {
+				value := value
+				setenv(t, key, &value)
+			}
+
+			args := tt.args
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+
+				args = append([]string{"-config", path}, args...)
+			}
+
+			cfg, err := Load(args)
+
+			if tt.wantError != "" {
+				var errs Errors
+				if !errors.As(err, &errs) || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Load() error = %v, want an error about %q", err, tt.wantError)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			if cfg.Limiter.RPS != tt.wantRPS {
+				t.Errorf("limiter.rps = %v, want %v", cfg.Limiter.RPS, tt.wantRPS)
+			}
+
+			if cfg.Port != tt.wantPort {
+				t.Errorf("port = %q, want %q", cfg.Port, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestWithReloadable(t *testing.T) {
+	tests := []struct {
+		name        string
+		change      func(c *Config)
+		check       func(c *Config) bool
+		wantIgnored []string
+	}{
+		{
+			name:   "unchanged",
+			change: func(c *Config) {},
+			check:  func(c *Config) bool { return reflect.DeepEqual(c, Default()) },
+		},
+		{
+			name:   "reloadable setting",
+			change: func(c *Config) { c.LogLevel = "debug" },
+			check:  func(c *Config) bool { return c.LogLevel == "debug" },
+		},
+		{
+			name:   "reloadable section",
+			change: func(c *Config) { c.Limiter.RPS = 10 },
+			check:  func(c *Config) bool { return c.Limiter.RPS == 10 },
+		},
+		{
+			name:        "setting requiring a restart",
+			change:      func(c *Config) { c.Port = ":5000" },
+			check:       func(c *Config) bool { return c.Port == "" },
+			wantIgnored: []string{"port"},
+		},
+		{
+			name:        "setting of a reloadable section requiring a restart",
+			change:      func(c *Config) { c.Limiter.Backend = "postgres"; c.Limiter.RPS = 10 },
+			check:       func(c *Config) bool { return c.Limiter.Backend == "memory" && c.Limiter.RPS == 10 },
+			wantIgnored: []string{"limiter.backend"},
+		},
+		{
+			name:        "section requiring a restart",
+			change:      func(c *Config) { c.DB.ReadTimeout = time.Minute },
+			check:       func(c *Config) bool { return c.DB.ReadTimeout != time.Minute },
+			wantIgnored: []string{"db.read_timeout"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, next := Default(), Default()
+			tt.change(next)
+
+			merged, ignored := current.WithReloadable(next)
+
+			if !tt.check(merged) {
+				t.Errorf("WithReloadable() = %+v, which does not have the expected settings", merged)
+			}
+
+			if !reflect.DeepEqual(ignored, tt.wantIgnored) {
+				t.Errorf("ignored = %v, want %v", ignored, tt.wantIgnored)
+			}
+
+			if !reflect.DeepEqual(current, Default()) {
+				t.Error("WithReloadable() changed the current configuration")
+			}
+		})
+	}
+}
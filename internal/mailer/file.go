@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileSender writes the messages to a maildir, so they can be read with
+// a mail client during development.
+type FileSender struct {
+	dir string
+}
+
+// NewFile returns a FileSender writing to the maildir dir, which is
+// created when it does not exist.
+func NewFile(dir string) (*FileSender, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileSender{dir: dir}, nil
+}
+
+// Send writes msg to the tmp directory of the maildir and moves it to the
+// new directory once it is complete, as the maildir readers expect.
+func (s *FileSender) Send(ctx context.Context, msg *Message) error {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.%s.eml", time.Now().UnixNano(), hex.EncodeToString(b))
+	tmp := filepath.Join(s.dir, "tmp", name)
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := mimeMessage(msg).WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(s.dir, "new", name))
+}
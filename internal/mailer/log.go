@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+)
+
+// LogSender logs the messages instead of sending them. The plain text body
+// is only logged at the debug level.
+type LogSender struct {
+	logger *logrus.Logger
+}
+
+func NewLog(logger *logrus.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(ctx context.Context, msg *Message) error {
+	entry := s.logger.WithContext(ctx).WithFields(map[string]interface{}{
+		"mail_to":       msg.To,
+		"mail_subject":  msg.Subject,
+		"mail_template": msg.Template,
+	})
+
+	if s.logger.IsLevelEnabled(logrus.DebugLevel) {
+		entry = entry.WithField("mail_body", msg.PlainBody)
+	}
+
+	entry.Info("mail sent to the log")
+
+	return nil
+}
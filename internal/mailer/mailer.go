@@ -1,69 +1,130 @@
+// Package mailer renders the email templates and delivers the messages
+// through a Sender, which is SMTP in production and a file, log or memory
+// backend in development and tests.
 package mailer
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/mail.v2"
 	"html/template"
-	"time"
 )
 
 //go:embed "templates"
 var templateFS embed.FS
 
-type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+var tracer = otel.Tracer("github.com/nebisin/api_structure/internal/mailer")
+
+// Message is a rendered email.
+type Message struct {
+	From      string
+	To        string
+	Subject   string
+	Template  string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Sender delivers the messages.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
+// Pinger is implemented by the senders which can check that their
+// server is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type Mailer struct {
+	sender Sender
+	from   string
+}
 
+func New(sender Sender, from string) Mailer {
 	return Mailer{
-		dialer: dialer,
 		sender: sender,
+		from:   from,
 	}
 }
 
-func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+// Send renders the template and makes a single attempt to send it to the
+// recipient, the retries are left to the caller. The sending is traced as
+// a span of ctx.
+func (m Mailer) Send(ctx context.Context, recipient, templateFile string, data interface{}) (err error) {
+	ctx, span := tracer.Start(ctx, "mailer.Send", trace.WithAttributes(attribute.String("mail.template", templateFile)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	msg, err := render(templateFile, data)
 	if err != nil {
 		return err
 	}
 
+	msg.From = m.from
+	msg.To = recipient
+
+	return m.sender.Send(ctx, msg)
+}
+
+// Ping checks that the server of the sender is reachable, when it has one.
+func (m Mailer) Ping(ctx context.Context) error {
+	if p, ok := m.sender.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+
+	return nil
+}
+
+// render executes the subject, plainBody and htmlBody templates of the
+// template file.
+func render(templateFile string, data interface{}) (*Message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
 	subject := new(bytes.Buffer)
 	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
-		return err
+		return nil, err
 	}
 
 	plainBody := new(bytes.Buffer)
 	if err := tmpl.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
-		return err
+		return nil, err
 	}
 
 	htmlBody := new(bytes.Buffer)
 	if err := tmpl.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
-		return err
+		return nil, err
 	}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
-
-	for i := 1; i <= 3; i++ {
-		err = m.dialer.DialAndSend(msg)
-
-		if nil == err {
-			return nil
-		}
+	return &Message{
+		Subject:   subject.String(),
+		Template:  templateFile,
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
 
-		time.Sleep(500 * time.Millisecond)
-	}
+// mimeMessage converts msg for gopkg.in/mail.v2, which formats it.
+func mimeMessage(msg *Message) *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
 
-	return err
+	return m
 }
-
@@ -0,0 +1,77 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+)
+
+// MemorySender keeps the messages in memory, so the tests can check
+// what has been sent.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemory() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, *msg)
+
+	return nil
+}
+
+// Messages returns the sent messages, the oldest first.
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, len(s.messages))
+	copy(messages, s.messages)
+
+	return messages
+}
+
+// SentTo returns the messages sent to the recipient, the oldest first.
+func (s *MemorySender) SentTo(recipient string) []Message {
+	return s.Filter(func(msg Message) bool {
+		return msg.To == recipient
+	})
+}
+
+// Filter returns the sent messages for which match returns true.
+func (s *MemorySender) Filter(match func(msg Message) bool) []Message {
+	var messages []Message
+
+	for _, msg := range s.Messages() {
+		if match(msg) {
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages
+}
+
+// Last returns the last sent message, if any.
+func (s *MemorySender) Last() (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.messages) == 0 {
+		return Message{}, false
+	}
+
+	return s.messages[len(s.messages)-1], true
+}
+
+// Reset forgets the sent messages.
+func (s *MemorySender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = nil
+}
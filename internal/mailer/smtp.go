@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/mail.v2"
+	"time"
+)
+
+// SMTPSender sends the messages to an SMTP server.
+type SMTPSender struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTP(host string, port int, username, password string) *SMTPSender {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPSender{dialer: dialer}
+}
+
+// Send makes a single attempt to send msg, traced as a span of ctx.
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	_, span := tracer.Start(ctx, "smtp send", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("server.address", s.dialer.Host),
+		attribute.Int("server.port", s.dialer.Port),
+	))
+	defer span.End()
+
+	err := s.dialer.DialAndSend(mimeMessage(msg))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// Ping checks that the SMTP server accepts a connection with the credentials.
+func (s *SMTPSender) Ping(ctx context.Context) error {
+	done := make(chan error, 1)
+
+	go func() {
+		conn, err := s.dialer.Dial()
+		if err == nil {
+			err = conn.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,352 @@
+// Package migrate applies the SQL migrations of the database schema. It
+// keeps track of the applied version in the same schema_migrations table
+// as golang-migrate, so databases migrated by the migrate CLI can be
+// managed by this package and the other way around.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// NilVersion is the version of a database without any applied migration.
+const NilVersion = -1
+
+// advisoryLockID is the key of the PostgreSQL advisory lock which is held
+// while migrating, so concurrent runners wait for each other.
+const advisoryLockID = 7_240_133_029
+
+var (
+	ErrNoChange = errors.New("no change")
+	ErrDirty    = errors.New("database is dirty, fix the failed migration and force the version")
+)
+
+var fileName = regexp.MustCompile(`^([0-9]+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+
+	// Logf reports every applied migration when it is set.
+	Logf func(format string, args ...interface{})
+}
+
+// New returns a Migrator for db with the migrations found in source.
+func New(db *sql.DB, source fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, entry := range entries {
+		matches := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+
+		body, err := fs.ReadFile(source, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, found := byVersion[version]
+		if !found {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has more than one name", version)
+		}
+
+		switch matches[3] {
+		case "up":
+			migration.Up = string(body)
+		case "down":
+			migration.Down = string(body)
+		}
+	}
+
+	m := &Migrator{db: db}
+
+	for _, migration := range byVersion {
+		m.migrations = append(m.migrations, migration)
+	}
+
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+
+	return m, nil
+}
+
+// Up applies all the pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.run(ctx, func(current int) int {
+		return len(m.migrations) - 1
+	})
+}
+
+// Down reverts all the applied migrations.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.run(ctx, func(current int) int {
+		return -1
+	})
+}
+
+// Steps applies n pending migrations when n is positive and reverts
+// -n applied migrations when n is negative.
+func (m *Migrator) Steps(ctx context.Context, n int) error {
+	return m.run(ctx, func(current int) int {
+		target := current + n
+
+		switch {
+		case target < -1:
+			return -1
+		case target >= len(m.migrations):
+			return len(m.migrations) - 1
+		}
+
+		return target
+	})
+}
+
+// Goto migrates up or down to version.
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	target, err := m.index(version)
+	if err != nil {
+		return err
+	}
+
+	return m.run(ctx, func(current int) int {
+		return target
+	})
+}
+
+// Version returns the current version and whether a migration
+// has failed halfway.
+func (m *Migrator) Version(ctx context.Context) (version int64, dirty bool, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err = m.version(ctx, conn)
+		return err
+	})
+
+	return version, dirty, err
+}
+
+// CurrentVersion returns the current version like Version, but without
+// waiting for a running migration to finish.
+func (m *Migrator) CurrentVersion(ctx context.Context) (version int64, dirty bool, err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer conn.Close()
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, false, err
+	}
+
+	if !exists {
+		return NilVersion, false, nil
+	}
+
+	return m.version(ctx, conn)
+}
+
+// Latest returns the version of the last migration,
+// or NilVersion when there is none.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return NilVersion
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Force sets the version without running any migration and clears
+// the dirty flag. It is used to recover from a failed migration.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if _, err := m.index(version); err != nil {
+		return err
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		return m.setVersion(ctx, conn, version, false)
+	})
+}
+
+// run migrates from the current version to the migration
+// at the index returned by target.
+func (m *Migrator) run(ctx context.Context, target func(current int) int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if dirty {
+			return fmt.Errorf("version %d: %w", version, ErrDirty)
+		}
+
+		current, err := m.index(version)
+		if err != nil {
+			return err
+		}
+
+		to := target(current)
+		if to == current {
+			return ErrNoChange
+		}
+
+		for i := current + 1; i <= to; i++ {
+			migration := m.migrations[i]
+
+			if err := m.apply(ctx, conn, migration.Version, migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+
+			m.logf("applied %d_%s", migration.Version, migration.Name)
+		}
+
+		for i := current; i > to; i-- {
+			migration := m.migrations[i]
+
+			previous := int64(NilVersion)
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+
+			if err := m.apply(ctx, conn, previous, migration.Down); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+
+			m.logf("reverted %d_%s", migration.Version, migration.Name)
+		}
+
+		return nil
+	})
+}
+
+// apply runs a migration and records the version it leads to. The version
+// stays dirty when the migration fails.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, version int64, query string) error {
+	if err := m.setVersion(ctx, conn, version, true); err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	return m.setVersion(ctx, conn, version, false)
+}
+
+// withLock runs fn on a dedicated connection holding the advisory lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockID)
+
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version bigint NOT NULL PRIMARY KEY,
+    dirty boolean NOT NULL
+)`
+
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) version(ctx context.Context, conn *sql.Conn) (int64, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+
+	err := conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return NilVersion, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+
+	return version, dirty, nil
+}
+
+func (m *Migrator) setVersion(ctx context.Context, conn *sql.Conn, version int64, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+
+	// A dirty NilVersion is stored as -1 like golang-migrate does.
+	if version != NilVersion || dirty {
+		_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, dirty)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// index returns the position of version in the migrations,
+// -1 being the position of NilVersion.
+func (m *Migrator) index(version int64) (int, error) {
+	if version == NilVersion {
+		return -1, nil
+	}
+
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown migration version %d", version)
+}
+
+func (m *Migrator) logf(format string, args ...interface{}) {
+	if m.Logf != nil {
+		m.Logf(format, args...)
+	}
+}
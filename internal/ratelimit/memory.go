@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"math"
+	"sync"
+	"time"
+)
+
+// memoryIdleTTL is how long the bucket of a key is kept after its last request.
+const memoryIdleTTL = 3 * time.Minute
+
+type memoryClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// MemoryLimiter is a Limiter keeping a token bucket per key in memory.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*memoryClient
+}
+
+func NewMemory() *MemoryLimiter {
+	return &MemoryLimiter{clients: make(map[string]*memoryClient)}
+}
+
+func (m *MemoryLimiter) Allow(ctx context.Context, key string, limit rate.Limit, burst int) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	c, found := m.clients[key]
+	if !found {
+		c = &memoryClient{limiter: rate.NewLimiter(limit, burst)}
+		m.clients[key] = c
+	}
+
+	c.lastSeen = now
+
+	// The limits of a key change when the configuration is reloaded.
+	if c.limiter.Limit() != limit || c.limiter.Burst() != burst {
+		c.limiter.SetLimitAt(now, limit)
+		c.limiter.SetBurstAt(now, burst)
+	}
+
+	reservation := c.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); !reservation.OK() || delay > 0 {
+		reservation.CancelAt(now)
+		return Result{Limit: burst, RetryAfter: delay}, nil
+	}
+
+	return Result{
+		Allowed:   true,
+		Limit:     burst,
+		Remaining: int(math.Max(0, c.limiter.TokensAt(now))),
+	}, nil
+}
+
+func (m *MemoryLimiter) DeleteExpired(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, c := range m.clients {
+		if time.Since(c.lastSeen) > memoryIdleTTL {
+			delete(m.clients, key)
+		}
+	}
+
+	return nil
+}
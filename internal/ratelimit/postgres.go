@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"golang.org/x/time/rate"
+	"math"
+	"time"
+)
+
+// PostgresLimiter is a Limiter counting the requests of every key in the
+// rate_limits table with a sliding window counter: the estimated number of
+// requests in the last window is the count of the current window plus the
+// count of the previous one, weighted by how much of it the last window
+// still covers.
+//
+// The windows are aligned on the clock of the server, which should be
+// kept in sync between the instances.
+type PostgresLimiter struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+func NewPostgres(db *sql.DB, timeout time.Duration) *PostgresLimiter {
+	return &PostgresLimiter{DB: db, Timeout: timeout}
+}
+
+// window is the sliding window of a limit at a point in time.
+type window struct {
+	size    time.Duration
+	start   time.Time
+	elapsed time.Duration
+}
+
+func newWindow(now time.Time, limit rate.Limit, burst int) window {
+	size := time.Duration(float64(burst) / float64(limit) * float64(time.Second)).Round(time.Microsecond)
+	if size < time.Microsecond {
+		size = time.Microsecond
+	}
+
+	start := now.Truncate(size)
+
+	return window{size: size, start: start, elapsed: now.Sub(start)}
+}
+
+// weight is the part of the previous window still covered by the last window.
+func (w window) weight() float64 {
+	return 1 - float64(w.elapsed)/float64(w.size)
+}
+
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, limit rate.Limit, burst int) (Result, error) {
+	if limit == rate.Inf {
+		return Result{Allowed: true, Limit: burst, Remaining: burst}, nil
+	}
+
+	// The update is skipped when the request is over the limit, so that
+	// rejected requests are not counted.
+	query := `
+		INSERT INTO rate_limits (key, window_start, count, previous_count, expires_at)
+		VALUES ($1, $2, 1, 0, $6)
+		ON CONFLICT (key) DO UPDATE SET
+			previous_count = CASE rate_limits.window_start
+				WHEN $2 THEN rate_limits.previous_count
+				WHEN $3 THEN rate_limits.count
+				ELSE 0 END,
+			count = CASE rate_limits.window_start
+				WHEN $2 THEN rate_limits.count + 1
+				ELSE 1 END,
+			window_start = $2,
+			expires_at = $6
+		WHERE CASE rate_limits.window_start
+				WHEN $2 THEN rate_limits.previous_count
+				WHEN $3 THEN rate_limits.count
+				ELSE 0 END * $4::double precision
+			+ CASE rate_limits.window_start
+				WHEN $2 THEN rate_limits.count
+				ELSE 0 END + 1 <= $5::double precision
+		RETURNING count, previous_count`
+
+	ctx, cancel := l.context(ctx)
+	defer cancel()
+
+	w := newWindow(time.Now(), limit, burst)
+
+	var count, previous int
+
+	err := l.DB.QueryRowContext(ctx, query, key, w.start, w.start.Add(-w.size), w.weight(), burst, w.start.Add(2*w.size)).Scan(&count, &previous)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return l.rejected(ctx, key, w, burst)
+		default:
+			return Result{}, err
+		}
+	}
+
+	return Result{
+		Allowed:   true,
+		Limit:     burst,
+		Remaining: int(math.Max(0, float64(burst)-float64(previous)*w.weight()-float64(count))),
+	}, nil
+}
+
+// rejected returns the result of a request over the limit, with the time
+// after which the estimated count of the window allows a request again.
+func (l *PostgresLimiter) rejected(ctx context.Context, key string, w window, burst int) (Result, error) {
+	query := `
+		SELECT window_start, count, previous_count
+		FROM rate_limits
+		WHERE key = $1`
+
+	var start time.Time
+	var count, previous float64
+
+	if err := l.DB.QueryRowContext(ctx, query, key).Scan(&start, &count, &previous); err != nil {
+		return Result{}, err
+	}
+
+	switch {
+	case start.Equal(w.start):
+	case start.Equal(w.start.Add(-w.size)):
+		count, previous = 0, count
+	default:
+		count, previous = 0, 0
+	}
+
+	spare := float64(burst) - 1
+	var retryAfter time.Duration
+
+	switch {
+	case count <= spare && previous > 0:
+		// Wait until enough of the previous window slid out.
+		retryAfter = time.Duration((1-(spare-count)/previous)*float64(w.size)) - w.elapsed
+	case count > spare:
+		// Wait for the next window, and for enough of this one to slide out.
+		retryAfter = w.size - w.elapsed + time.Duration(math.Max(0, 1-spare/count)*float64(w.size))
+	}
+
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+
+	return Result{Limit: burst, RetryAfter: retryAfter}, nil
+}
+
+func (l *PostgresLimiter) DeleteExpired(ctx context.Context) error {
+	query := `DELETE FROM rate_limits WHERE expires_at < now()`
+
+	ctx, cancel := l.context(ctx)
+	defer cancel()
+
+	_, err := l.DB.ExecContext(ctx, query)
+	return err
+}
+
+func (l *PostgresLimiter) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, l.Timeout)
+}
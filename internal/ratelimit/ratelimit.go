@@ -0,0 +1,35 @@
+// Package ratelimit counts the requests of the clients of the server
+// against their limits.
+//
+// A limit is given as a rate of requests per second and a burst. The
+// in-memory limiter applies it as a token bucket, which holds only within
+// a single process; the Postgres limiter applies it as a sliding window of
+// burst requests every burst/rate seconds, shared by every instance using
+// the same database.
+package ratelimit
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"time"
+)
+
+// Result is the outcome of counting a request.
+type Result struct {
+	// Allowed reports whether the request is within its limit.
+	Allowed bool
+	// Limit is the number of requests allowed in a burst.
+	Limit int
+	// Remaining is the number of requests left in the current burst.
+	Remaining int
+	// RetryAfter is the time after which a rejected request is allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter counts requests by key.
+type Limiter interface {
+	// Allow counts a request of key against the given limit.
+	Allow(ctx context.Context, key string, limit rate.Limit, burst int) (Result, error)
+	// DeleteExpired forgets the keys which have not been seen for a while.
+	DeleteExpired(ctx context.Context) error
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	ResourcePost = "post"
+
+	SubjectUser = "user"
+	SubjectRole = "role"
+
+	ActionRead  = "read"
+	ActionWrite = "write"
+)
+
+// ACLEntry grants an action on a single resource, or on every resource
+// of a type when ResourceID is nil, to a user or to every user of a role.
+type ACLEntry struct {
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   *int64    `json:"resource_id"`
+	SubjectType  string    `json:"subject_type"`
+	SubjectID    int64     `json:"subject_id"`
+	Action       string    `json:"action"`
+}
+
+type aclRepository struct {
+	DB       dbtx
+	timeouts Timeouts
+}
+
+// Insert method stores a new ACL entry. ErrDuplicateACLEntry is returned
+// when the same entry already exists.
+func (r *aclRepository) Insert(ctx context.Context, entry *ACLEntry) error {
+	query := `INSERT INTO acl_entries (resource_type, resource_id, subject_type, subject_id, action)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT DO NOTHING
+RETURNING id, created_at`
+
+	args := []interface{}{entry.ResourceType, entry.ResourceID, entry.SubjectType, entry.SubjectID, entry.Action}
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrDuplicateACLEntry
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete method removes an ACL entry.
+func (r *aclRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM acl_entries
+WHERE id = $1`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForResource method returns the entries of a resource type. When
+// resourceID is not nil only the entries which apply to that resource,
+// including the entries for every resource of the type, are returned.
+func (r *aclRepository) GetAllForResource(ctx context.Context, resourceType string, resourceID *int64) ([]*ACLEntry, error) {
+	query := `SELECT id, created_at, resource_type, resource_id, subject_type, subject_id, action
+FROM acl_entries
+WHERE resource_type = $1 AND ($2::bigint IS NULL OR resource_id = $2 OR resource_id IS NULL)
+ORDER BY id ASC`
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, resourceType, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []*ACLEntry{}
+
+	for rows.Next() {
+		var entry ACLEntry
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.ResourceType,
+			&entry.ResourceID,
+			&entry.SubjectType,
+			&entry.SubjectID,
+			&entry.Action,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Allowed method reports whether any entry grants one of the actions on
+// the resource to the user, either directly or through one of the roles
+// assigned to the user.
+func (r *aclRepository) Allowed(ctx context.Context, resourceType string, resourceID, userID int64, actions ...string) (bool, error) {
+	query := `SELECT EXISTS (
+SELECT 1
+FROM acl_entries
+WHERE resource_type = $1 AND (resource_id = $2 OR resource_id IS NULL) AND action = ANY($4)
+AND ((subject_type = 'user' AND subject_id = $3)
+OR (subject_type = 'role' AND subject_id IN (SELECT role_id FROM users_roles WHERE user_id = $3))))`
+
+	var allowed bool
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, resourceType, resourceID, userID, pq.Array(actions)).Scan(&allowed)
+	return allowed, err
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Actions recorded in the audit log, by the server and by the commands.
+const (
+	AuditLogin              = "auth.login"
+	AuditLoginFailed        = "auth.login_failed"
+	AuditTokenCreate        = "token.create"
+	AuditTokenRevoke        = "token.revoke"
+	AuditImpersonationStart = "impersonation.start"
+	AuditUserCreate         = "user.create"
+	AuditUserActivate       = "user.activate"
+	AuditPermissionCreate   = "permission.create"
+	AuditPermissionGrant    = "permission.grant"
+	AuditPermissionRevoke   = "permission.revoke"
+	AuditRoleCreate         = "role.create"
+	AuditRoleUpdate         = "role.update"
+	AuditRoleAssign         = "role.assign"
+	AuditRoleUnassign       = "role.unassign"
+	AuditACLCreate          = "acl.create"
+	AuditACLDelete          = "acl.delete"
+	AuditInvitationCreate   = "invitation.create"
+	AuditInvitationDelete   = "invitation.delete"
+	AuditIPRuleCreate       = "ip_rule.create"
+	AuditIPRuleDelete       = "ip_rule.delete"
+	AuditOutboxRedrive      = "outbox.redrive"
+	AuditPostCreate         = "post.create"
+	AuditPostUpdate         = "post.update"
+	AuditPostDelete         = "post.delete"
+)
+
+// AuditEvent is a persistent record of a security or content event.
+// Before and After hold JSON snapshots of the changed resource.
+type AuditEvent struct {
+	ID             int64           `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Action         string          `json:"action"`
+	ActorID        int64           `json:"actor_id,omitempty"`
+	ImpersonatorID int64           `json:"impersonator_id,omitempty"`
+	ResourceType   string          `json:"resource_type,omitempty"`
+	ResourceID     string          `json:"resource_id,omitempty"`
+	IP             string          `json:"ip,omitempty"`
+	RequestID      string          `json:"request_id,omitempty"`
+	Before         json.RawMessage `json:"before,omitempty"`
+	After          json.RawMessage `json:"after,omitempty"`
+	Metadata       json.RawMessage `json:"metadata,omitempty"`
+}
+
+// AuditEntry describes an event to be recorded in the audit log, with
+// the snapshots of the resource before and after the change.
+type AuditEntry struct {
+	Action       string
+	ActorID      int64
+	ResourceType string
+	ResourceID   int64
+	Before       interface{}
+	After        interface{}
+	Metadata     map[string]interface{}
+}
+
+// NewAuditEvent builds the audit event of an entry, encoding its snapshots
+// and its metadata. Nil values are left empty.
+func NewAuditEvent(entry AuditEntry) (*AuditEvent, error) {
+	event := &AuditEvent{
+		Action:       entry.Action,
+		ActorID:      entry.ActorID,
+		ResourceType: entry.ResourceType,
+	}
+
+	if entry.ResourceID != 0 {
+		event.ResourceID = strconv.FormatInt(entry.ResourceID, 10)
+	}
+
+	var err error
+
+	if event.Before, err = marshalAuditSnapshot(entry.Before); err != nil {
+		return nil, err
+	}
+	if event.After, err = marshalAuditSnapshot(entry.After); err != nil {
+		return nil, err
+	}
+	if event.Metadata, err = marshalAuditSnapshot(entry.Metadata); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// marshalAuditSnapshot encodes a snapshot, leaving nil values empty.
+func marshalAuditSnapshot(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// AuditFilter selects audit events. Zero values are ignored. Events are
+// returned newest first, starting below the Cursor id when it is set.
+type AuditFilter struct {
+	Action       string
+	ActorID      int64
+	ResourceType string
+	ResourceID   string
+	Since        time.Time
+	Until        time.Time
+	Cursor       int64 `validate:"gte=0"`
+	Limit        int   `validate:"gt=0,lte=100"`
+}
+
+type auditRepository struct {
+	DB       dbtx
+	timeouts Timeouts
+}
+
+// Insert method stores a new audit event.
+func (r *auditRepository) Insert(ctx context.Context, event *AuditEvent) error {
+	query := `INSERT INTO audit_events
+(action, actor_id, impersonator_id, resource_type, resource_id, ip, request_id, before, after, metadata)
+VALUES ($1, NULLIF($2::bigint, 0), NULLIF($3::bigint, 0), $4, $5, $6, $7, $8, $9, $10)
+RETURNING id, created_at`
+
+	args := []interface{}{
+		event.Action,
+		event.ActorID,
+		event.ImpersonatorID,
+		event.ResourceType,
+		event.ResourceID,
+		event.IP,
+		event.RequestID,
+		nullJSON(event.Before),
+		nullJSON(event.After),
+		nullJSON(event.Metadata),
+	}
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	return r.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt)
+}
+
+// GetAll method returns the events matching the filter and the cursor
+// for the next page, which is zero when there are no more events.
+func (r *auditRepository) GetAll(ctx context.Context, filter AuditFilter) ([]*AuditEvent, int64, error) {
+	query := `SELECT id, created_at, action, COALESCE(actor_id, 0), COALESCE(impersonator_id, 0),
+resource_type, resource_id, ip, request_id, before, after, metadata
+FROM audit_events
+WHERE (action = $1 OR $1 = '')
+AND (actor_id = $2 OR $2 = 0)
+AND (resource_type = $3 OR $3 = '')
+AND (resource_id = $4 OR $4 = '')
+AND ($5::timestamptz IS NULL OR created_at >= $5)
+AND ($6::timestamptz IS NULL OR created_at < $6)
+AND (id < $7 OR $7 = 0)
+ORDER BY id DESC
+LIMIT $8`
+
+	args := []interface{}{
+		filter.Action,
+		filter.ActorID,
+		filter.ResourceType,
+		filter.ResourceID,
+		nullTime(filter.Since),
+		nullTime(filter.Until),
+		filter.Cursor,
+		filter.Limit + 1,
+	}
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	events := make([]*AuditEvent, 0, filter.Limit)
+
+	for rows.Next() {
+		var (
+			event                   AuditEvent
+			before, after, metadata []byte
+		)
+
+		err := rows.Scan(
+			&event.ID,
+			&event.CreatedAt,
+			&event.Action,
+			&event.ActorID,
+			&event.ImpersonatorID,
+			&event.ResourceType,
+			&event.ResourceID,
+			&event.IP,
+			&event.RequestID,
+			&before,
+			&after,
+			&metadata,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		event.Before = before
+		event.After = after
+		event.Metadata = metadata
+
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var next int64
+
+	if len(events) > filter.Limit {
+		events = events[:filter.Limit]
+		next = events[len(events)-1].ID
+	}
+
+	return events, next, nil
+}
+
+// nullJSON turns an empty JSON document into a SQL NULL.
+func nullJSON(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return string(data)
+}
+
+// nullTime turns the zero time into a SQL NULL.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewAuditEvent(t *testing.T) {
+	tests := []struct {
+		name         string
+		entry        AuditEntry
+		wantResource string
+		wantBefore   string
+		wantAfter    string
+		wantMetadata string
+	}{
+		{
+			name:  "action only",
+			entry: AuditEntry{Action: AuditLogin, ActorID: 3},
+		},
+		{
+			name:         "change",
+			entry:        AuditEntry{Action: AuditRoleUpdate, ResourceType: "role", ResourceID: 7, Before: Role{Name: "a"}, After: Role{Name: "b"}},
+			wantResource: "7",
+			wantBefore:   `"name":"a"`,
+			wantAfter:    `"name":"b"`,
+		},
+		{
+			name:         "metadata",
+			entry:        AuditEntry{Action: AuditPermissionGrant, ResourceType: "user", ResourceID: 1, Metadata: map[string]interface{}{"codes": []string{"posts:read"}}},
+			wantResource: "1",
+			wantMetadata: `{"codes":["posts:read"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := NewAuditEvent(tt.entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if event.Action != tt.entry.Action || event.ActorID != tt.entry.ActorID || event.ResourceType != tt.entry.ResourceType {
+				t.Errorf("NewAuditEvent() = %+v, which does not match %+v", event, tt.entry)
+			}
+
+			if event.ResourceID != tt.wantResource {
+				t.Errorf("resource id = %q, want %q", event.ResourceID, tt.wantResource)
+			}
+
+			for _, snapshot := range []struct {
+				name string
+				got  string
+				want string
+			}{
+				{"before", string(event.Before), tt.wantBefore},
+				{"after", string(event.After), tt.wantAfter},
+				{"metadata", string(event.Metadata), tt.wantMetadata},
+			} {
+				if !containsOrEmpty(snapshot.got, snapshot.want) {
+					t.Errorf("%s = %s, want %s", snapshot.name, snapshot.got, snapshot.want)
+				}
+			}
+		})
+	}
+}
+
+// containsOrEmpty reports whether got contains want, or whether both are
+// empty when want is.
+func containsOrEmpty(got, want string) bool {
+	if want == "" {
+		return got == ""
+	}
+
+	return strings.Contains(got, want)
+}
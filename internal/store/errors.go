@@ -8,4 +8,9 @@ var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
 	ErrDuplicateEmail = errors.New("duplicate email")
+
+	ErrDuplicatePermission = errors.New("duplicate permission")
+	ErrDuplicateRole       = errors.New("duplicate role")
+	ErrDuplicateACLEntry   = errors.New("duplicate acl entry")
+	ErrDuplicateIPRule     = errors.New("duplicate ip rule")
 )
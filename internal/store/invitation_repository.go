@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Invitation allows a single email address to register while the
+// registration is invite-only. The invited user is activated right away
+// and gets the roles of the invitation.
+type Invitation struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Plaintext  string     `json:"-"`
+	Hash       []byte     `json:"-"`
+	Email      string     `json:"email"`
+	Roles      []string   `json:"roles"`
+	InvitedBy  int64      `json:"invited_by"`
+	Expiry     time.Time  `json:"expiry"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+type invitationRepository struct {
+	DB       dbtx
+	timeouts Timeouts
+}
+
+// New method creates and stores an invitation with a fresh token.
+func (r *invitationRepository) New(ctx context.Context, email string, roles []string, invitedBy int64, ttl time.Duration) (*Invitation, error) {
+	plaintext, hash, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &Invitation{
+		Plaintext: plaintext,
+		Hash:      hash,
+		Email:     email,
+		Roles:     roles,
+		InvitedBy: invitedBy,
+		Expiry:    time.Now().Add(ttl),
+	}
+
+	if invitation.Roles == nil {
+		invitation.Roles = []string{}
+	}
+
+	query := `INSERT INTO invitations (hash, email, roles, invited_by, expiry)
+VALUES ($1, $2, $3, NULLIF($4::bigint, 0), $5)
+RETURNING id, created_at`
+
+	args := []interface{}{invitation.Hash, invitation.Email, pq.Array(invitation.Roles), invitation.InvitedBy, invitation.Expiry}
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	err = r.DB.QueryRowContext(ctx, query, args...).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// GetForToken method returns the pending invitation of the token.
+// Expired and already accepted invitations are not returned.
+func (r *invitationRepository) GetForToken(ctx context.Context, tokenPlaintext string) (*Invitation, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `SELECT id, created_at, hash, email, roles, COALESCE(invited_by, 0), expiry, accepted_at
+FROM invitations
+WHERE hash = $1 AND expiry > $2 AND accepted_at IS NULL`
+
+	var invitation Invitation
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now()).Scan(
+		&invitation.ID,
+		&invitation.CreatedAt,
+		&invitation.Hash,
+		&invitation.Email,
+		pq.Array(&invitation.Roles),
+		&invitation.InvitedBy,
+		&invitation.Expiry,
+		&invitation.AcceptedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &invitation, nil
+}
+
+// MarkAccepted method marks a pending invitation as accepted. It returns
+// ErrEditConflict if the invitation has been accepted in the meantime.
+func (r *invitationRepository) MarkAccepted(ctx context.Context, invitation *Invitation) error {
+	query := `UPDATE invitations SET accepted_at = now()
+WHERE id = $1 AND accepted_at IS NULL
+RETURNING accepted_at`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, invitation.ID).Scan(&invitation.AcceptedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAll method returns every invitation, newest first.
+func (r *invitationRepository) GetAll(ctx context.Context) ([]*Invitation, error) {
+	query := `SELECT id, created_at, email, roles, COALESCE(invited_by, 0), expiry, accepted_at
+FROM invitations
+ORDER BY id DESC`
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+
+	for rows.Next() {
+		var invitation Invitation
+
+		err := rows.Scan(
+			&invitation.ID,
+			&invitation.CreatedAt,
+			&invitation.Email,
+			pq.Array(&invitation.Roles),
+			&invitation.InvitedBy,
+			&invitation.Expiry,
+			&invitation.AcceptedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		invitations = append(invitations, &invitation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// Delete method revokes an invitation.
+func (r *invitationRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM invitations
+WHERE id = $1`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
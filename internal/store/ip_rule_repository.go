@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	IPRuleAllow = "allow"
+	IPRuleDeny  = "deny"
+)
+
+// IPRule allows or denies the requests from a network to the routes under
+// a path prefix.
+type IPRule struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	PathPrefix string    `json:"path_prefix"`
+	Action     string    `json:"action"`
+	CIDR       string    `json:"cidr"`
+	Comment    string    `json:"comment"`
+}
+
+type ipRuleRepository struct {
+	DB       dbtx
+	timeouts Timeouts
+}
+
+// Insert method stores a new IP rule. ErrDuplicateIPRule is returned
+// when the same rule already exists.
+func (r *ipRuleRepository) Insert(ctx context.Context, rule *IPRule) error {
+	query := `INSERT INTO ip_rules (path_prefix, action, cidr, comment)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT DO NOTHING
+RETURNING id, created_at`
+
+	args := []interface{}{rule.PathPrefix, rule.Action, rule.CIDR, rule.Comment}
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&rule.ID, &rule.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrDuplicateIPRule
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete method removes an IP rule.
+func (r *ipRuleRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM ip_rules
+WHERE id = $1`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll method returns every IP rule.
+func (r *ipRuleRepository) GetAll(ctx context.Context) ([]*IPRule, error) {
+	query := `SELECT id, created_at, path_prefix, action, cidr, comment
+FROM ip_rules
+ORDER BY id ASC`
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	rules := []*IPRule{}
+
+	for rows.Next() {
+		var rule IPRule
+
+		err := rows.Scan(
+			&rule.ID,
+			&rule.CreatedAt,
+			&rule.PathPrefix,
+			&rule.Action,
+			&rule.CIDR,
+			&rule.Comment,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, &rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
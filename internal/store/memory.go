@@ -0,0 +1,498 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	errMemoryDuplicateKey = errors.New("memory store: duplicate key")
+	errMemoryForeignKey   = errors.New("memory store: foreign key violation")
+)
+
+// memoryDB holds the tables of the in-memory store. All repositories
+// returned by NewMemoryModels share one memoryDB and its lock, so the
+// repositories can look into each other's tables like SQL joins do.
+type memoryDB struct {
+	mu sync.RWMutex
+
+	// txMu is held by a running transaction, which works on a copy of
+	// the tables swapped in on commit. The writers outside transactions
+	// take it too, see lock, so no write is lost by the swap.
+	txMu sync.Mutex
+
+	posts            map[int64]*Post
+	users            map[int64]*User
+	tokens           map[string]*Token
+	permissions      map[int64]*Permission
+	usersPermissions map[int64]map[int64]bool
+	roles            map[int64]*Role
+	rolesPermissions map[int64]map[int64]bool
+	usersRoles       map[int64]map[int64]bool
+	acl              map[int64]*ACLEntry
+	invitations      map[int64]*Invitation
+	ipRules          map[int64]*IPRule
+	outbox           map[int64]*OutboxMessage
+	audit            []*AuditEvent
+
+	sequences map[string]int64
+}
+
+// memorySeed mirrors the permission codes and roles which are inserted by
+// the migrations, so the in-memory store starts in the same state as a
+// freshly migrated database.
+var memorySeed = struct {
+	permissions []string
+	roles       map[string][]string
+}{
+	permissions: []string{
+		"posts:read", "posts:write", "permissions:read", "permissions:write",
+		"*", "posts:*", "metrics:read", "posts:moderate",
+		"invitations:read", "invitations:write", "users:impersonate", "audit:read",
+		"ip_rules:read", "ip_rules:write", "outbox:read", "outbox:write",
+	},
+	roles: map[string][]string{
+		"reader": {"posts:read"},
+		"author": {"posts:read", "posts:write"},
+		"editor": {"posts:read", "posts:write", "permissions:read", "posts:moderate"},
+		"admin":  {"posts:read", "posts:write", "permissions:read", "permissions:write", "*"},
+	},
+}
+
+// NewMemoryModels returns thread-safe in-memory repositories with the same
+// semantics as the PostgreSQL repositories. Nothing is persisted, which
+// makes them suitable for tests and for local development. The permission
+// lookups are cached in permissionCache, which may be nil.
+//
+// A transaction works on its own copy of the tables, so the other readers
+// do not see its changes before it commits. The transactions and the
+// writes made outside of them run one at a time, which is stricter than
+// the serializable isolation of PostgreSQL but never fails.
+func NewMemoryModels(permissionCache *PermissionCache) Models {
+	db := &memoryDB{
+		posts:            make(map[int64]*Post),
+		users:            make(map[int64]*User),
+		tokens:           make(map[string]*Token),
+		permissions:      make(map[int64]*Permission),
+		usersPermissions: make(map[int64]map[int64]bool),
+		roles:            make(map[int64]*Role),
+		rolesPermissions: make(map[int64]map[int64]bool),
+		usersRoles:       make(map[int64]map[int64]bool),
+		acl:              make(map[int64]*ACLEntry),
+		invitations:      make(map[int64]*Invitation),
+		ipRules:          make(map[int64]*IPRule),
+		outbox:           make(map[int64]*OutboxMessage),
+		sequences:        make(map[string]int64),
+	}
+
+	for _, code := range memorySeed.permissions {
+		id := db.nextID("permissions")
+		db.permissions[id] = &Permission{ID: id, Code: code}
+	}
+
+	names := make([]string, 0, len(memorySeed.roles))
+	for name := range memorySeed.roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		id := db.nextID("roles")
+		db.roles[id] = &Role{ID: id, Name: name}
+		db.rolesPermissions[id] = make(map[int64]bool)
+
+		for _, permissionID := range db.permissionIDs(memorySeed.roles[name]) {
+			db.rolesPermissions[id][permissionID] = true
+		}
+	}
+
+	models := newMemoryRepositories(db, permissionCache)
+	models.withTx = func(ctx context.Context, fn func(Models) error) error {
+		db.txMu.Lock()
+		defer db.txMu.Unlock()
+
+		db.mu.RLock()
+		work := db.clone()
+		db.mu.RUnlock()
+
+		txCache := permissionCache.begin()
+
+		txModels := newMemoryRepositories(work, txCache)
+		txModels.withTx = func(ctx context.Context, fn func(Models) error) error {
+			return fn(txModels)
+		}
+
+		err := fn(txModels)
+
+		db.mu.Lock()
+		// Like PostgreSQL, the ids taken by a rolled back transaction
+		// are not reused.
+		db.sequences = work.sequences
+		if err == nil {
+			db.restore(work.tables())
+		}
+		db.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		txCache.commit()
+
+		return nil
+	}
+
+	return models
+}
+
+func newMemoryRepositories(db *memoryDB, permissionCache permissionCacher) Models {
+	return Models{
+		ACL:         &memoryACLRepository{db},
+		Audit:       &memoryAuditRepository{db},
+		Invitations: &memoryInvitationRepository{db},
+		IPRules:     &memoryIPRuleRepository{db},
+		Outbox:      &memoryOutboxRepository{db},
+		Permissions: &memoryPermissionRepository{db, permissionCache},
+		Posts:       &memoryPostRepository{db},
+		Roles:       &memoryRoleRepository{db, permissionCache},
+		Tokens:      &memoryTokenRepository{db},
+		Users:       &memoryUserRepository{db},
+	}
+}
+
+// memorySnapshot is a deep copy of the tables of a memoryDB.
+type memorySnapshot struct {
+	posts            map[int64]*Post
+	users            map[int64]*User
+	tokens           map[string]*Token
+	permissions      map[int64]*Permission
+	usersPermissions map[int64]map[int64]bool
+	roles            map[int64]*Role
+	rolesPermissions map[int64]map[int64]bool
+	usersRoles       map[int64]map[int64]bool
+	acl              map[int64]*ACLEntry
+	invitations      map[int64]*Invitation
+	ipRules          map[int64]*IPRule
+	outbox           map[int64]*OutboxMessage
+	audit            []*AuditEvent
+}
+
+func (db *memoryDB) snapshot() *memorySnapshot {
+	s := &memorySnapshot{
+		posts:            make(map[int64]*Post, len(db.posts)),
+		users:            make(map[int64]*User, len(db.users)),
+		tokens:           make(map[string]*Token, len(db.tokens)),
+		permissions:      make(map[int64]*Permission, len(db.permissions)),
+		usersPermissions: copyRelation(db.usersPermissions),
+		roles:            make(map[int64]*Role, len(db.roles)),
+		rolesPermissions: copyRelation(db.rolesPermissions),
+		usersRoles:       copyRelation(db.usersRoles),
+		acl:              make(map[int64]*ACLEntry, len(db.acl)),
+		invitations:      make(map[int64]*Invitation, len(db.invitations)),
+		ipRules:          make(map[int64]*IPRule, len(db.ipRules)),
+		outbox:           make(map[int64]*OutboxMessage, len(db.outbox)),
+		audit:            append([]*AuditEvent(nil), db.audit...),
+	}
+
+	for id, post := range db.posts {
+		s.posts[id] = copyPost(post)
+	}
+
+	for id, user := range db.users {
+		s.users[id] = copyUser(user)
+	}
+
+	for key, token := range db.tokens {
+		c := *token
+		s.tokens[key] = &c
+	}
+
+	for id, permission := range db.permissions {
+		c := *permission
+		s.permissions[id] = &c
+	}
+
+	for id, role := range db.roles {
+		c := *role
+		s.roles[id] = &c
+	}
+
+	for id, entry := range db.acl {
+		s.acl[id] = copyACLEntry(entry)
+	}
+
+	for id, invitation := range db.invitations {
+		s.invitations[id] = copyInvitation(invitation)
+	}
+
+	for id, rule := range db.ipRules {
+		c := *rule
+		s.ipRules[id] = &c
+	}
+
+	for id, msg := range db.outbox {
+		s.outbox[id] = copyOutboxMessage(msg)
+	}
+
+	return s
+}
+
+// clone returns a copy of db for a transaction.
+func (db *memoryDB) clone() *memoryDB {
+	c := &memoryDB{sequences: make(map[string]int64, len(db.sequences))}
+
+	for table, id := range db.sequences {
+		c.sequences[table] = id
+	}
+
+	c.restore(db.snapshot())
+
+	return c
+}
+
+// tables returns the tables of db, without copying them.
+func (db *memoryDB) tables() *memorySnapshot {
+	return &memorySnapshot{
+		posts:            db.posts,
+		users:            db.users,
+		tokens:           db.tokens,
+		permissions:      db.permissions,
+		usersPermissions: db.usersPermissions,
+		roles:            db.roles,
+		rolesPermissions: db.rolesPermissions,
+		usersRoles:       db.usersRoles,
+		acl:              db.acl,
+		invitations:      db.invitations,
+		ipRules:          db.ipRules,
+		outbox:           db.outbox,
+		audit:            db.audit,
+	}
+}
+
+// restore replaces the tables with the snapshot. The sequences are kept.
+func (db *memoryDB) restore(s *memorySnapshot) {
+	db.posts = s.posts
+	db.users = s.users
+	db.tokens = s.tokens
+	db.permissions = s.permissions
+	db.usersPermissions = s.usersPermissions
+	db.roles = s.roles
+	db.rolesPermissions = s.rolesPermissions
+	db.usersRoles = s.usersRoles
+	db.acl = s.acl
+	db.invitations = s.invitations
+	db.ipRules = s.ipRules
+	db.outbox = s.outbox
+	db.audit = s.audit
+}
+
+func copyRelation(relation map[int64]map[int64]bool) map[int64]map[int64]bool {
+	c := make(map[int64]map[int64]bool, len(relation))
+
+	for id, ids := range relation {
+		c[id] = make(map[int64]bool, len(ids))
+		for k, v := range ids {
+			c[id][k] = v
+		}
+	}
+
+	return c
+}
+
+// lock takes the write lock of db. It waits for the running transaction,
+// whose working copy would otherwise overwrite the write on commit.
+func (db *memoryDB) lock() {
+	db.txMu.Lock()
+	db.mu.Lock()
+}
+
+func (db *memoryDB) unlock() {
+	db.mu.Unlock()
+	db.txMu.Unlock()
+}
+
+// The helpers below must be called with the lock of the memoryDB held.
+
+func (db *memoryDB) nextID(table string) int64 {
+	db.sequences[table]++
+	return db.sequences[table]
+}
+
+// permissionIDs returns the ids of the known permission codes,
+// unknown codes are skipped like the SQL joins do.
+func (db *memoryDB) permissionIDs(codes []string) []int64 {
+	var ids []int64
+
+	for id, permission := range db.permissions {
+		for _, code := range codes {
+			if permission.Code == code {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+
+	return ids
+}
+
+// roleIDs returns the ids of the known role names.
+func (db *memoryDB) roleIDs(names []string) []int64 {
+	var ids []int64
+
+	for id, role := range db.roles {
+		for _, name := range names {
+			if role.Name == name {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+
+	return ids
+}
+
+// permissionCodes returns the sorted codes of the permission ids.
+func (db *memoryDB) permissionCodes(ids map[int64]bool) Permissions {
+	var codes Permissions
+
+	for id := range ids {
+		if permission, found := db.permissions[id]; found {
+			codes = append(codes, permission.Code)
+		}
+	}
+
+	sort.Strings(codes)
+
+	return codes
+}
+
+func (db *memoryDB) userForToken(tokenPlaintext string, scopes ...string) (*User, *Token) {
+	hash := hashToken(tokenPlaintext)
+
+	token, found := db.tokens[string(hash)]
+	if !found || !time.Now().Before(token.Expiry) {
+		return nil, nil
+	}
+
+	for _, scope := range scopes {
+		if token.Scope == scope {
+			user, found := db.users[token.UserID]
+			if !found {
+				return nil, nil
+			}
+
+			return copyUser(user), token
+		}
+	}
+
+	return nil, nil
+}
+
+func (db *memoryDB) emailTaken(email string, exceptID int64) bool {
+	for id, user := range db.users {
+		if id != exceptID && user.Email == email {
+			return true
+		}
+	}
+
+	return false
+}
+
+// now returns the current time rounded to seconds, matching the
+// timestamp(0) columns of the database.
+func now() time.Time {
+	return time.Now().Round(time.Second)
+}
+
+func copyPost(post *Post) *Post {
+	c := *post
+	if post.Tags != nil {
+		c.Tags = append([]string{}, post.Tags...)
+	}
+	return &c
+}
+
+func copyUser(user *User) *User {
+	c := *user
+	c.Password.Plaintext = nil
+	c.Password.Hash = append([]byte{}, user.Password.Hash...)
+	c.Impersonator = nil
+	return &c
+}
+
+func copyInvitation(invitation *Invitation) *Invitation {
+	c := *invitation
+	c.Roles = append([]string{}, invitation.Roles...)
+	if invitation.AcceptedAt != nil {
+		acceptedAt := *invitation.AcceptedAt
+		c.AcceptedAt = &acceptedAt
+	}
+	return &c
+}
+
+func copyOutboxMessage(msg *OutboxMessage) *OutboxMessage {
+	c := *msg
+	c.Data = append(json.RawMessage(nil), msg.Data...)
+	if msg.SentAt != nil {
+		sentAt := *msg.SentAt
+		c.SentAt = &sentAt
+	}
+	return &c
+}
+
+func copyACLEntry(entry *ACLEntry) *ACLEntry {
+	c := *entry
+	if entry.ResourceID != nil {
+		resourceID := *entry.ResourceID
+		c.ResourceID = &resourceID
+	}
+	return &c
+}
+
+// matchTitle emulates to_tsvector('simple', title) @@
+// plainto_tsquery('simple', query): every word of the query has to be a
+// word of the title, ignoring case.
+func matchTitle(title, query string) bool {
+	words := make(map[string]bool)
+	for _, word := range splitWords(title) {
+		words[word] = true
+	}
+
+	for _, word := range splitWords(query) {
+		if !words[word] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func containsAll(values, subset []string) bool {
+	for _, v := range subset {
+		found := false
+		for i := range values {
+			if values[i] == v {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,1074 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+type memoryPostRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryPostRepository) Insert(ctx context.Context, post *Post) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	if post.UserID != 0 {
+		if _, found := r.db.users[post.UserID]; !found {
+			return errMemoryForeignKey
+		}
+	}
+
+	post.ID = r.db.nextID("posts")
+	post.CreatedAt = now()
+	post.Version = 1
+
+	r.db.posts[post.ID] = copyPost(post)
+
+	return nil
+}
+
+func (r *memoryPostRepository) Get(ctx context.Context, id int64) (*Post, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	post, found := r.db.posts[id]
+	if !found {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyPost(post), nil
+}
+
+func (r *memoryPostRepository) Update(ctx context.Context, post *Post) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	stored, found := r.db.posts[post.ID]
+	if !found || stored.Version != post.Version {
+		return ErrEditConflict
+	}
+
+	updated := copyPost(stored)
+	updated.Title = post.Title
+	updated.Body = post.Body
+	updated.Tags = append([]string(nil), post.Tags...)
+	updated.Private = post.Private
+	updated.Version++
+
+	r.db.posts[post.ID] = updated
+	post.Version = updated.Version
+
+	return nil
+}
+
+func (r *memoryPostRepository) Delete(ctx context.Context, id int64) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	if _, found := r.db.posts[id]; !found {
+		return ErrRecordNotFound
+	}
+
+	delete(r.db.posts, id)
+
+	for entryID, entry := range r.db.acl {
+		if entry.ResourceType == ResourcePost && entry.ResourceID != nil && *entry.ResourceID == id {
+			delete(r.db.acl, entryID)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryPostRepository) GetAll(ctx context.Context, title string, tags []string, access PostAccess, filters Filters) ([]*Post, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var posts []*Post
+
+	for _, post := range r.db.posts {
+		if title != "" && !matchTitle(post.Title, title) {
+			continue
+		}
+
+		if len(tags) > 0 && !containsAll(post.Tags, tags) {
+			continue
+		}
+
+		if !r.visible(post, access) {
+			continue
+		}
+
+		c := copyPost(post)
+		c.Body = ""
+		posts = append(posts, c)
+	}
+
+	desc := filters.sortDirection() == "DESC"
+
+	sort.Slice(posts, func(i, j int) bool {
+		if filters.sortColumn() == "title" && posts[i].Title != posts[j].Title {
+			return (posts[i].Title < posts[j].Title) != desc
+		}
+
+		if filters.sortColumn() == "id" && desc {
+			return posts[i].ID > posts[j].ID
+		}
+
+		return posts[i].ID < posts[j].ID
+	})
+
+	result := make([]*Post, 0, filters.Limit)
+
+	for i := filters.offset(); i < len(posts) && len(result) < filters.Limit; i++ {
+		result = append(result, posts[i])
+	}
+
+	return result, nil
+}
+
+func (r *memoryPostRepository) visible(post *Post, access PostAccess) bool {
+	if access.All || !post.Private || (post.UserID != 0 && post.UserID == access.UserID) {
+		return true
+	}
+
+	return r.db.aclAllowed(ResourcePost, post.ID, access.UserID, ActionRead, ActionWrite)
+}
+
+type memoryUserRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryUserRepository) Insert(ctx context.Context, user *User) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	if r.db.emailTaken(user.Email, 0) {
+		return ErrDuplicateEmail
+	}
+
+	user.ID = r.db.nextID("users")
+	user.CreatedAt = now()
+	user.Version = 1
+
+	r.db.users[user.ID] = copyUser(user)
+
+	return nil
+}
+
+func (r *memoryUserRepository) Get(ctx context.Context, id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	user, found := r.db.users[id]
+	if !found {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyUser(user), nil
+}
+
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, user := range r.db.users {
+		if user.Email == email {
+			return copyUser(user), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (r *memoryUserRepository) Update(ctx context.Context, user *User) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	stored, found := r.db.users[user.ID]
+	if !found || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	if r.db.emailTaken(user.Email, user.ID) {
+		return ErrDuplicateEmail
+	}
+
+	updated := copyUser(user)
+	updated.CreatedAt = stored.CreatedAt
+	updated.Version++
+
+	r.db.users[user.ID] = updated
+	user.Version = updated.Version
+
+	return nil
+}
+
+func (r *memoryUserRepository) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	user, _ := r.db.userForToken(tokenPlaintext, tokenScope)
+	if user == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return user, nil
+}
+
+func (r *memoryUserRepository) GetForAuthentication(ctx context.Context, tokenPlaintext string) (*User, int64, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	user, token := r.db.userForToken(tokenPlaintext, ScopeAuthentication, ScopeImpersonation)
+	if user == nil {
+		return nil, 0, ErrRecordNotFound
+	}
+
+	return user, token.ImpersonatorID, nil
+}
+
+type memoryTokenRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryTokenRepository) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Insert(ctx, token)
+	return token, err
+}
+
+func (r *memoryTokenRepository) NewImpersonation(ctx context.Context, userID, impersonatorID int64, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeImpersonation)
+	if err != nil {
+		return nil, err
+	}
+
+	token.ImpersonatorID = impersonatorID
+
+	err = r.Insert(ctx, token)
+	return token, err
+}
+
+func (r *memoryTokenRepository) Insert(ctx context.Context, token *Token) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	if _, found := r.db.users[token.UserID]; !found {
+		return errMemoryForeignKey
+	}
+
+	if token.ImpersonatorID != 0 {
+		if _, found := r.db.users[token.ImpersonatorID]; !found {
+			return errMemoryForeignKey
+		}
+	}
+
+	key := string(token.Hash)
+	if _, found := r.db.tokens[key]; found {
+		return errMemoryDuplicateKey
+	}
+
+	c := *token
+	c.Plaintext = ""
+	c.Hash = append([]byte{}, token.Hash...)
+	r.db.tokens[key] = &c
+
+	return nil
+}
+
+func (r *memoryTokenRepository) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	for key, token := range r.db.tokens {
+		if token.Scope == scope && token.UserID == userID {
+			delete(r.db.tokens, key)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	r.db.lock()
+	defer r.db.unlock()
+
+	var deleted int64
+
+	for key, token := range r.db.tokens {
+		if token.Expiry.Before(time.Now()) {
+			delete(r.db.tokens, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+type memoryPermissionRepository struct {
+	db    *memoryDB
+	cache permissionCacher
+}
+
+func (r *memoryPermissionRepository) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	permissions, generation, found := r.cache.get(userID)
+	if found {
+		return permissions, nil
+	}
+
+	r.db.mu.RLock()
+
+	ids := make(map[int64]bool)
+
+	for id := range r.db.usersPermissions[userID] {
+		ids[id] = true
+	}
+
+	for roleID := range r.db.usersRoles[userID] {
+		for id := range r.db.rolesPermissions[roleID] {
+			ids[id] = true
+		}
+	}
+
+	permissions = r.db.permissionCodes(ids)
+
+	r.db.mu.RUnlock()
+
+	r.cache.set(userID, permissions, generation)
+
+	return permissions, nil
+}
+
+func (r *memoryPermissionRepository) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	ids := r.db.permissionIDs(codes)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, found := r.db.users[userID]; !found {
+		return errMemoryForeignKey
+	}
+
+	if r.db.usersPermissions[userID] == nil {
+		r.db.usersPermissions[userID] = make(map[int64]bool)
+	}
+
+	for _, id := range ids {
+		r.db.usersPermissions[userID][id] = true
+	}
+
+	r.cache.Invalidate(userID)
+
+	return nil
+}
+
+func (r *memoryPermissionRepository) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	for _, id := range r.db.permissionIDs(codes) {
+		delete(r.db.usersPermissions[userID], id)
+	}
+
+	r.cache.Invalidate(userID)
+
+	return nil
+}
+
+func (r *memoryPermissionRepository) GetAll(ctx context.Context) ([]*Permission, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	permissions := []*Permission{}
+
+	for _, permission := range r.db.permissions {
+		c := *permission
+		permissions = append(permissions, &c)
+	}
+
+	sort.Slice(permissions, func(i, j int) bool {
+		return permissions[i].Code < permissions[j].Code
+	})
+
+	return permissions, nil
+}
+
+func (r *memoryPermissionRepository) Insert(ctx context.Context, permission *Permission) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	for _, p := range r.db.permissions {
+		if p.Code == permission.Code {
+			return ErrDuplicatePermission
+		}
+	}
+
+	permission.ID = r.db.nextID("permissions")
+
+	c := *permission
+	r.db.permissions[permission.ID] = &c
+
+	return nil
+}
+
+type memoryRoleRepository struct {
+	db    *memoryDB
+	cache permissionCacher
+}
+
+func (r *memoryRoleRepository) GetAll(ctx context.Context) ([]*Role, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	roles := []*Role{}
+
+	for _, role := range r.db.roles {
+		roles = append(roles, r.role(role))
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	return roles, nil
+}
+
+func (r *memoryRoleRepository) GetByName(ctx context.Context, name string) (*Role, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, role := range r.db.roles {
+		if role.Name == name {
+			return r.role(role), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// role returns a copy of the role with its permission codes.
+func (r *memoryRoleRepository) role(role *Role) *Role {
+	permissions := r.db.permissionCodes(r.db.rolesPermissions[role.ID])
+	if permissions == nil {
+		permissions = Permissions{}
+	}
+
+	return &Role{ID: role.ID, Name: role.Name, Permissions: permissions}
+}
+
+func (r *memoryRoleRepository) Insert(ctx context.Context, role *Role) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	for _, existing := range r.db.roles {
+		if existing.Name == role.Name {
+			return ErrDuplicateRole
+		}
+	}
+
+	role.ID = r.db.nextID("roles")
+
+	r.db.roles[role.ID] = &Role{ID: role.ID, Name: role.Name}
+	r.db.rolesPermissions[role.ID] = make(map[int64]bool)
+
+	return nil
+}
+
+func (r *memoryRoleRepository) AddPermissions(ctx context.Context, roleID int64, codes ...string) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	ids := r.db.permissionIDs(codes)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, found := r.db.roles[roleID]; !found {
+		return errMemoryForeignKey
+	}
+
+	for _, id := range ids {
+		r.db.rolesPermissions[roleID][id] = true
+	}
+
+	r.cache.InvalidateAll()
+
+	return nil
+}
+
+func (r *memoryRoleRepository) RemovePermissions(ctx context.Context, roleID int64, codes ...string) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	for _, id := range r.db.permissionIDs(codes) {
+		delete(r.db.rolesPermissions[roleID], id)
+	}
+
+	r.cache.InvalidateAll()
+
+	return nil
+}
+
+func (r *memoryRoleRepository) GetAllForUser(ctx context.Context, userID int64) ([]string, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	roles := []string{}
+
+	for id := range r.db.usersRoles[userID] {
+		if role, found := r.db.roles[id]; found {
+			roles = append(roles, role.Name)
+		}
+	}
+
+	sort.Strings(roles)
+
+	return roles, nil
+}
+
+func (r *memoryRoleRepository) AddForUser(ctx context.Context, userID int64, names ...string) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	ids := r.db.roleIDs(names)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, found := r.db.users[userID]; !found {
+		return errMemoryForeignKey
+	}
+
+	if r.db.usersRoles[userID] == nil {
+		r.db.usersRoles[userID] = make(map[int64]bool)
+	}
+
+	for _, id := range ids {
+		r.db.usersRoles[userID][id] = true
+	}
+
+	r.cache.Invalidate(userID)
+
+	return nil
+}
+
+func (r *memoryRoleRepository) RemoveForUser(ctx context.Context, userID int64, names ...string) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	for _, id := range r.db.roleIDs(names) {
+		delete(r.db.usersRoles[userID], id)
+	}
+
+	r.cache.Invalidate(userID)
+
+	return nil
+}
+
+type memoryACLRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryACLRepository) Insert(ctx context.Context, entry *ACLEntry) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	for _, existing := range r.db.acl {
+		if existing.ResourceType == entry.ResourceType &&
+			resourceKey(existing.ResourceID) == resourceKey(entry.ResourceID) &&
+			existing.SubjectType == entry.SubjectType &&
+			existing.SubjectID == entry.SubjectID &&
+			existing.Action == entry.Action {
+			return ErrDuplicateACLEntry
+		}
+	}
+
+	entry.ID = r.db.nextID("acl_entries")
+	entry.CreatedAt = now()
+
+	r.db.acl[entry.ID] = copyACLEntry(entry)
+
+	return nil
+}
+
+func (r *memoryACLRepository) Delete(ctx context.Context, id int64) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	if _, found := r.db.acl[id]; !found {
+		return ErrRecordNotFound
+	}
+
+	delete(r.db.acl, id)
+
+	return nil
+}
+
+func (r *memoryACLRepository) GetAllForResource(ctx context.Context, resourceType string, resourceID *int64) ([]*ACLEntry, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	entries := []*ACLEntry{}
+
+	for _, entry := range r.db.acl {
+		if entry.ResourceType != resourceType {
+			continue
+		}
+
+		if resourceID != nil && entry.ResourceID != nil && *entry.ResourceID != *resourceID {
+			continue
+		}
+
+		entries = append(entries, copyACLEntry(entry))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	return entries, nil
+}
+
+func (r *memoryACLRepository) Allowed(ctx context.Context, resourceType string, resourceID, userID int64, actions ...string) (bool, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	return r.db.aclAllowed(resourceType, resourceID, userID, actions...), nil
+}
+
+// aclAllowed must be called with the lock of the memoryDB held.
+func (db *memoryDB) aclAllowed(resourceType string, resourceID, userID int64, actions ...string) bool {
+	for _, entry := range db.acl {
+		if entry.ResourceType != resourceType {
+			continue
+		}
+
+		if entry.ResourceID != nil && *entry.ResourceID != resourceID {
+			continue
+		}
+
+		if !containsAll(actions, []string{entry.Action}) {
+			continue
+		}
+
+		switch entry.SubjectType {
+		case SubjectUser:
+			if entry.SubjectID == userID {
+				return true
+			}
+		case SubjectRole:
+			if db.usersRoles[userID][entry.SubjectID] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func resourceKey(resourceID *int64) int64 {
+	if resourceID == nil {
+		return 0
+	}
+
+	return *resourceID
+}
+
+type memoryInvitationRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryInvitationRepository) New(ctx context.Context, email string, roles []string, invitedBy int64, ttl time.Duration) (*Invitation, error) {
+	plaintext, hash, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &Invitation{
+		Plaintext: plaintext,
+		Hash:      hash,
+		Email:     email,
+		Roles:     roles,
+		InvitedBy: invitedBy,
+		Expiry:    time.Now().Add(ttl),
+	}
+
+	if invitation.Roles == nil {
+		invitation.Roles = []string{}
+	}
+
+	r.db.lock()
+	defer r.db.unlock()
+
+	invitation.ID = r.db.nextID("invitations")
+	invitation.CreatedAt = now()
+
+	stored := copyInvitation(invitation)
+	stored.Plaintext = ""
+	r.db.invitations[invitation.ID] = stored
+
+	return invitation, nil
+}
+
+func (r *memoryInvitationRepository) GetForToken(ctx context.Context, tokenPlaintext string) (*Invitation, error) {
+	hash := string(hashToken(tokenPlaintext))
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, invitation := range r.db.invitations {
+		if string(invitation.Hash) == hash && time.Now().Before(invitation.Expiry) && invitation.AcceptedAt == nil {
+			return copyInvitation(invitation), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (r *memoryInvitationRepository) MarkAccepted(ctx context.Context, invitation *Invitation) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	stored, found := r.db.invitations[invitation.ID]
+	if !found || stored.AcceptedAt != nil {
+		return ErrEditConflict
+	}
+
+	acceptedAt := now()
+	stored.AcceptedAt = &acceptedAt
+	invitation.AcceptedAt = &acceptedAt
+
+	return nil
+}
+
+func (r *memoryInvitationRepository) GetAll(ctx context.Context) ([]*Invitation, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	invitations := []*Invitation{}
+
+	for _, invitation := range r.db.invitations {
+		c := copyInvitation(invitation)
+		c.Hash = nil
+		invitations = append(invitations, c)
+	}
+
+	sort.Slice(invitations, func(i, j int) bool {
+		return invitations[i].ID > invitations[j].ID
+	})
+
+	return invitations, nil
+}
+
+func (r *memoryInvitationRepository) Delete(ctx context.Context, id int64) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	if _, found := r.db.invitations[id]; !found {
+		return ErrRecordNotFound
+	}
+
+	delete(r.db.invitations, id)
+
+	return nil
+}
+
+type memoryIPRuleRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryIPRuleRepository) Insert(ctx context.Context, rule *IPRule) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	for _, existing := range r.db.ipRules {
+		if existing.PathPrefix == rule.PathPrefix && existing.Action == rule.Action && existing.CIDR == rule.CIDR {
+			return ErrDuplicateIPRule
+		}
+	}
+
+	rule.ID = r.db.nextID("ip_rules")
+	rule.CreatedAt = now()
+
+	c := *rule
+	r.db.ipRules[rule.ID] = &c
+
+	return nil
+}
+
+func (r *memoryIPRuleRepository) Delete(ctx context.Context, id int64) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	if _, found := r.db.ipRules[id]; !found {
+		return ErrRecordNotFound
+	}
+
+	delete(r.db.ipRules, id)
+
+	return nil
+}
+
+func (r *memoryIPRuleRepository) GetAll(ctx context.Context) ([]*IPRule, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	rules := make([]*IPRule, 0, len(r.db.ipRules))
+
+	for _, rule := range r.db.ipRules {
+		c := *rule
+		rules = append(rules, &c)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+
+	return rules, nil
+}
+
+type memoryAuditRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryAuditRepository) Insert(ctx context.Context, event *AuditEvent) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	event.ID = r.db.nextID("audit_events")
+	event.CreatedAt = now()
+
+	c := *event
+	r.db.audit = append(r.db.audit, &c)
+
+	return nil
+}
+
+func (r *memoryAuditRepository) GetAll(ctx context.Context, filter AuditFilter) ([]*AuditEvent, int64, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	events := make([]*AuditEvent, 0, filter.Limit)
+
+	for i := len(r.db.audit) - 1; i >= 0 && len(events) <= filter.Limit; i-- {
+		event := r.db.audit[i]
+
+		switch {
+		case filter.Action != "" && event.Action != filter.Action,
+			filter.ActorID != 0 && event.ActorID != filter.ActorID,
+			filter.ResourceType != "" && event.ResourceType != filter.ResourceType,
+			filter.ResourceID != "" && event.ResourceID != filter.ResourceID,
+			!filter.Since.IsZero() && event.CreatedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !event.CreatedAt.Before(filter.Until),
+			filter.Cursor != 0 && event.ID >= filter.Cursor:
+			continue
+		}
+
+		c := *event
+		events = append(events, &c)
+	}
+
+	var next int64
+
+	if len(events) > filter.Limit {
+		events = events[:filter.Limit]
+		next = events[len(events)-1].ID
+	}
+
+	return events, next, nil
+}
+
+type memoryOutboxRepository struct {
+	db *memoryDB
+}
+
+func (r *memoryOutboxRepository) Insert(ctx context.Context, msg *OutboxMessage) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	msg.ID = r.db.nextID("email_outbox")
+	msg.CreatedAt = now()
+	msg.Status = OutboxPending
+	msg.NextAttemptAt = msg.CreatedAt
+
+	if len(msg.Data) == 0 {
+		msg.Data = json.RawMessage("{}")
+	}
+
+	r.db.outbox[msg.ID] = copyOutboxMessage(msg)
+
+	return nil
+}
+
+func (r *memoryOutboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]*OutboxMessage, error) {
+	r.db.lock()
+	defer r.db.unlock()
+
+	current := now()
+
+	var due []*OutboxMessage
+
+	for _, msg := range r.db.outbox {
+		if msg.Status == OutboxPending && !msg.NextAttemptAt.After(current) {
+			due = append(due, msg)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	messages := make([]*OutboxMessage, 0, len(due))
+
+	for _, msg := range due {
+		msg.Attempts++
+		msg.NextAttemptAt = current.Add(lease)
+
+		messages = append(messages, copyOutboxMessage(msg))
+	}
+
+	return messages, nil
+}
+
+func (r *memoryOutboxRepository) MarkSent(ctx context.Context, msg *OutboxMessage) error {
+	return r.update(msg, func(msg *OutboxMessage) {
+		sentAt := now()
+
+		msg.Status = OutboxSent
+		msg.SentAt = &sentAt
+		msg.Data = json.RawMessage("{}")
+		msg.LastError = ""
+	})
+}
+
+func (r *memoryOutboxRepository) Retry(ctx context.Context, msg *OutboxMessage, lastError string, at time.Time) error {
+	return r.update(msg, func(msg *OutboxMessage) {
+		msg.NextAttemptAt = at.Round(time.Second)
+		msg.LastError = lastError
+	})
+}
+
+func (r *memoryOutboxRepository) MarkDead(ctx context.Context, msg *OutboxMessage, lastError string) error {
+	return r.update(msg, func(msg *OutboxMessage) {
+		msg.Status = OutboxDead
+		msg.LastError = lastError
+	})
+}
+
+func (r *memoryOutboxRepository) Redrive(ctx context.Context, msg *OutboxMessage) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	stored, found := r.db.outbox[msg.ID]
+	if !found || stored.Status != OutboxDead {
+		return ErrEditConflict
+	}
+
+	stored.Status = OutboxPending
+	stored.Attempts = 0
+	stored.NextAttemptAt = now()
+
+	msg.Status = stored.Status
+	msg.Attempts = stored.Attempts
+	msg.NextAttemptAt = stored.NextAttemptAt
+
+	return nil
+}
+
+func (r *memoryOutboxRepository) Get(ctx context.Context, id int64) (*OutboxMessage, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	msg, found := r.db.outbox[id]
+	if !found {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyOutboxMessage(msg), nil
+}
+
+func (r *memoryOutboxRepository) GetAll(ctx context.Context, filter OutboxFilter) ([]*OutboxMessage, int64, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	messages := make([]*OutboxMessage, 0, len(r.db.outbox))
+
+	for _, msg := range r.db.outbox {
+		switch {
+		case filter.Status != "" && msg.Status != filter.Status,
+			filter.Cursor != 0 && msg.ID >= filter.Cursor:
+			continue
+		}
+
+		messages = append(messages, copyOutboxMessage(msg))
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ID > messages[j].ID
+	})
+
+	var next int64
+
+	if len(messages) > filter.Limit {
+		messages = messages[:filter.Limit]
+		next = messages[len(messages)-1].ID
+	}
+
+	return messages, next, nil
+}
+
+func (r *memoryOutboxRepository) DeleteSent(ctx context.Context, before time.Time) (int64, error) {
+	r.db.lock()
+	defer r.db.unlock()
+
+	var deleted int64
+
+	for id, msg := range r.db.outbox {
+		if msg.Status == OutboxSent && msg.SentAt.Before(before) {
+			delete(r.db.outbox, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *memoryOutboxRepository) update(claimed *OutboxMessage, fn func(msg *OutboxMessage)) error {
+	r.db.lock()
+	defer r.db.unlock()
+
+	msg, found := r.db.outbox[claimed.ID]
+	if !found || msg.Attempts != claimed.Attempts || msg.Status != OutboxPending {
+		return ErrEditConflict
+	}
+
+	fn(msg)
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryWithTx(t *testing.T) {
+	errRollback := errors.New("rollback")
+
+	tests := []struct {
+		name          string
+		err           error
+		wantCommitted bool
+	}{
+		{"commit", nil, true},
+		{"rollback", errRollback, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cache := NewPermissionCache(time.Minute)
+			models := NewMemoryModels(cache)
+
+			existing := &User{Name: "Existing", Email: "existing@example.com"}
+			if err := models.Users.Insert(ctx, existing); err != nil {
+				t.Fatal(err)
+			}
+
+			err := models.WithTx(ctx, func(m Models) error {
+				user := &User{Name: "Alice", Email: "alice@example.com"}
+				if err := m.Users.Insert(ctx, user); err != nil {
+					return err
+				}
+
+				if err := m.Permissions.AddForUser(ctx, existing.ID, "posts:write"); err != nil {
+					return err
+				}
+
+				// The change is visible in the transaction, but not outside
+				// of it before the commit.
+				if _, err := m.Users.GetByEmail(ctx, user.Email); err != nil {
+					t.Errorf("GetByEmail in the transaction: %v", err)
+				}
+
+				if _, err := models.Users.GetByEmail(ctx, user.Email); !errors.Is(err, ErrRecordNotFound) {
+					t.Errorf("GetByEmail outside of the transaction: err = %v, want ErrRecordNotFound", err)
+				}
+
+				permissions, err := models.Permissions.GetAllForUser(ctx, existing.ID)
+				if err != nil {
+					return err
+				}
+				if permissions.Include("posts:write") {
+					t.Error("uncommitted permission visible outside of the transaction")
+				}
+
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("WithTx: err = %v, want %v", err, tt.err)
+			}
+
+			_, err = models.Users.GetByEmail(ctx, "alice@example.com")
+			if committed := err == nil; committed != tt.wantCommitted {
+				t.Errorf("user committed = %v, want %v (err = %v)", committed, tt.wantCommitted, err)
+			}
+
+			permissions, err := models.Permissions.GetAllForUser(ctx, existing.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := permissions.Include("posts:write"); got != tt.wantCommitted {
+				t.Errorf("permission committed = %v, want %v", got, tt.wantCommitted)
+			}
+
+			// Rows inserted after the transaction do not reuse its ids.
+			next := &User{Name: "Bob", Email: "bob@example.com"}
+			if err := models.Users.Insert(ctx, next); err != nil {
+				t.Fatal(err)
+			}
+			if next.ID <= existing.ID {
+				t.Errorf("next user id = %d, want more than %d", next.ID, existing.ID)
+			}
+		})
+	}
+}
@@ -1,19 +1,192 @@
 package store
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	_ "github.com/lib/pq"
+	"time"
+)
 
+// Models groups the repositories of the application. Every repository is
+// an interface implemented by the PostgreSQL repositories returned by
+// NewModels and by the in-memory repositories returned by NewMemoryModels.
 type Models struct {
-	Permissions permissionRepository
-	Posts       postRepository
-	Tokens      tokenRepository
-	Users       userRepository
+	ACL         ACLRepository
+	Audit       AuditRepository
+	Invitations InvitationRepository
+	IPRules     IPRuleRepository
+	Outbox      OutboxRepository
+	Permissions PermissionRepository
+	Posts       PostRepository
+	Roles       RoleRepository
+	Tokens      TokenRepository
+	Users       UserRepository
+
+	withTx func(ctx context.Context, fn func(Models) error) error
+}
+
+// WithTx runs fn in a transaction. The repositories passed to fn are bound
+// to the transaction, which is committed when fn returns nil and rolled
+// back otherwise. Serialization failures are retried, so fn may run more
+// than once and must not have side effects outside of the store. Calling
+// WithTx on the models passed to fn runs in the same transaction.
+func (m Models) WithTx(ctx context.Context, fn func(Models) error) error {
+	return m.withTx(ctx, fn)
+}
+
+type ACLRepository interface {
+	Insert(ctx context.Context, entry *ACLEntry) error
+	Delete(ctx context.Context, id int64) error
+	GetAllForResource(ctx context.Context, resourceType string, resourceID *int64) ([]*ACLEntry, error)
+	Allowed(ctx context.Context, resourceType string, resourceID, userID int64, actions ...string) (bool, error)
+}
+
+type AuditRepository interface {
+	Insert(ctx context.Context, event *AuditEvent) error
+	GetAll(ctx context.Context, filter AuditFilter) ([]*AuditEvent, int64, error)
+}
+
+type InvitationRepository interface {
+	New(ctx context.Context, email string, roles []string, invitedBy int64, ttl time.Duration) (*Invitation, error)
+	GetForToken(ctx context.Context, tokenPlaintext string) (*Invitation, error)
+	MarkAccepted(ctx context.Context, invitation *Invitation) error
+	GetAll(ctx context.Context) ([]*Invitation, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+type IPRuleRepository interface {
+	Insert(ctx context.Context, rule *IPRule) error
+	Delete(ctx context.Context, id int64) error
+	GetAll(ctx context.Context) ([]*IPRule, error)
+}
+
+type OutboxRepository interface {
+	Insert(ctx context.Context, msg *OutboxMessage) error
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]*OutboxMessage, error)
+	MarkSent(ctx context.Context, msg *OutboxMessage) error
+	Retry(ctx context.Context, msg *OutboxMessage, lastError string, at time.Time) error
+	MarkDead(ctx context.Context, msg *OutboxMessage, lastError string) error
+	Redrive(ctx context.Context, msg *OutboxMessage) error
+	Get(ctx context.Context, id int64) (*OutboxMessage, error)
+	GetAll(ctx context.Context, filter OutboxFilter) ([]*OutboxMessage, int64, error)
+	DeleteSent(ctx context.Context, before time.Time) (int64, error)
+}
+
+type PermissionRepository interface {
+	GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+	AddForUser(ctx context.Context, userID int64, codes ...string) error
+	RemoveForUser(ctx context.Context, userID int64, codes ...string) error
+	GetAll(ctx context.Context) ([]*Permission, error)
+	Insert(ctx context.Context, permission *Permission) error
+}
+
+type PostRepository interface {
+	Insert(ctx context.Context, post *Post) error
+	Get(ctx context.Context, id int64) (*Post, error)
+	Update(ctx context.Context, post *Post) error
+	Delete(ctx context.Context, id int64) error
+	GetAll(ctx context.Context, title string, tags []string, access PostAccess, filters Filters) ([]*Post, error)
+}
+
+type RoleRepository interface {
+	GetAll(ctx context.Context) ([]*Role, error)
+	GetByName(ctx context.Context, name string) (*Role, error)
+	Insert(ctx context.Context, role *Role) error
+	AddPermissions(ctx context.Context, roleID int64, codes ...string) error
+	RemovePermissions(ctx context.Context, roleID int64, codes ...string) error
+	GetAllForUser(ctx context.Context, userID int64) ([]string, error)
+	AddForUser(ctx context.Context, userID int64, names ...string) error
+	RemoveForUser(ctx context.Context, userID int64, names ...string) error
+}
+
+type TokenRepository interface {
+	New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+	NewImpersonation(ctx context.Context, userID, impersonatorID int64, ttl time.Duration) (*Token, error)
+	Insert(ctx context.Context, token *Token) error
+	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type UserRepository interface {
+	Insert(ctx context.Context, user *User) error
+	Get(ctx context.Context, id int64) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+	GetForAuthentication(ctx context.Context, tokenPlaintext string) (*User, int64, error)
 }
 
-func NewModels(db *sql.DB) Models {
+// Timeouts bounds the duration of a single repository operation on top of
+// the deadline of the context passed by the caller. A zero value disables
+// the additional deadline.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+// DefaultTimeouts are used by the command line tools and as flag defaults.
+var DefaultTimeouts = Timeouts{Read: 3 * time.Second, Write: 5 * time.Second}
+
+func (t Timeouts) read(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Read)
+}
+
+func (t Timeouts) write(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Write)
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// NewModels returns the repositories backed by db. Every operation is bounded
+// by timeouts. The permission lookups are cached in permissionCache, which
+// may be nil to disable caching.
+func NewModels(db *sql.DB, timeouts Timeouts, permissionCache *PermissionCache) Models {
+	models := newSQLModels(db, timeouts, permissionCache)
+	models.withTx = func(ctx context.Context, fn func(Models) error) error {
+		return runTx(ctx, db, timeouts, permissionCache, fn)
+	}
+
+	return models
+}
+
+func newSQLModels(db dbtx, timeouts Timeouts, permissionCache permissionCacher) Models {
+	db = tracedDB{db}
+
 	return Models{
-		Permissions: permissionRepository{db},
-		Posts:       postRepository{db},
-		Tokens:      tokenRepository{db},
-		Users:       userRepository{db},
+		ACL:         &aclRepository{db, timeouts},
+		Audit:       &auditRepository{db, timeouts},
+		Invitations: &invitationRepository{db, timeouts},
+		IPRules:     &ipRuleRepository{db, timeouts},
+		Outbox:      &outboxRepository{db, timeouts},
+		Permissions: &permissionRepository{db, timeouts, permissionCache},
+		Posts:       &postRepository{db, timeouts},
+		Roles:       &roleRepository{db, timeouts, permissionCache},
+		Tokens:      &tokenRepository{db, timeouts},
+		Users:       &userRepository{db, timeouts},
 	}
 }
+
+// OpenDB opens a PostgreSQL connection pool for the given DSN
+// and verifies it by pinging the database.
+func OpenDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
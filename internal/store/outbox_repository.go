@@ -0,0 +1,291 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+// OutboxMessage is an email waiting to be sent by the outbox workers. Data
+// holds the template data, which may contain tokens, so it is not exposed
+// and it is cleared once the message is sent.
+//
+// Delivery is at least once: a message whose worker sends it but does not
+// record it before the lease expires is sent again.
+type OutboxMessage struct {
+	ID            int64           `json:"id"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Recipient     string          `json:"recipient"`
+	Template      string          `json:"template"`
+	Data          json.RawMessage `json:"-"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     string          `json:"last_error,omitempty"`
+	SentAt        *time.Time      `json:"sent_at,omitempty"`
+	RequestID     string          `json:"request_id,omitempty"`
+}
+
+// OutboxFilter selects outbox messages. A zero Status matches every status.
+// Messages are returned newest first, starting below the Cursor id when it
+// is set.
+type OutboxFilter struct {
+	Status string `validate:"omitempty,oneof=pending sent dead"`
+	Cursor int64  `validate:"gte=0"`
+	Limit  int    `validate:"gt=0,lte=100"`
+}
+
+type outboxRepository struct {
+	DB       dbtx
+	timeouts Timeouts
+}
+
+const outboxColumns = `id, created_at, recipient, template, data, status, attempts,
+next_attempt_at, last_error, sent_at, request_id`
+
+// Insert method adds a pending message to the outbox.
+func (r *outboxRepository) Insert(ctx context.Context, msg *OutboxMessage) error {
+	query := `INSERT INTO email_outbox (recipient, template, data, request_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, status, next_attempt_at`
+
+	if len(msg.Data) == 0 {
+		msg.Data = json.RawMessage("{}")
+	}
+
+	args := []interface{}{msg.Recipient, msg.Template, []byte(msg.Data), msg.RequestID}
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	return r.DB.QueryRowContext(ctx, query, args...).Scan(&msg.ID, &msg.CreatedAt, &msg.Status, &msg.NextAttemptAt)
+}
+
+// Claim method takes up to limit pending messages which are due and counts
+// an attempt for each of them. The claimed messages are not due again
+// before the lease expires, so a message whose worker stops before
+// recording the result is retried later. Concurrent claims skip the rows
+// locked by each other. The attempts of a claimed message identify the
+// claim, the result of the attempt is only recorded while it still holds.
+func (r *outboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]*OutboxMessage, error) {
+	query := `UPDATE email_outbox
+SET attempts = attempts + 1, next_attempt_at = now() + make_interval(secs => $2)
+WHERE id IN (
+    SELECT id FROM email_outbox
+    WHERE status = 'pending' AND next_attempt_at <= now()
+    ORDER BY next_attempt_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING ` + outboxColumns
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	return scanOutboxMessages(rows)
+}
+
+// MarkSent method records that a claimed message has been sent.
+// ErrEditConflict is returned when the message has been claimed again since.
+func (r *outboxRepository) MarkSent(ctx context.Context, msg *OutboxMessage) error {
+	query := `UPDATE email_outbox
+SET status = 'sent', sent_at = now(), data = '{}', last_error = ''
+WHERE id = $1 AND attempts = $2 AND status = 'pending'`
+
+	return r.update(ctx, query, msg.ID, msg.Attempts)
+}
+
+// Retry method records a failed attempt of a claimed message and schedules
+// the next one. ErrEditConflict is returned when the message has been
+// claimed again since.
+func (r *outboxRepository) Retry(ctx context.Context, msg *OutboxMessage, lastError string, at time.Time) error {
+	query := `UPDATE email_outbox
+SET next_attempt_at = $3, last_error = $4
+WHERE id = $1 AND attempts = $2 AND status = 'pending'`
+
+	return r.update(ctx, query, msg.ID, msg.Attempts, at, lastError)
+}
+
+// MarkDead method records a failed attempt of a claimed message after which
+// it is not retried anymore, unless it is redriven. ErrEditConflict is
+// returned when the message has been claimed again since.
+func (r *outboxRepository) MarkDead(ctx context.Context, msg *OutboxMessage, lastError string) error {
+	query := `UPDATE email_outbox
+SET status = 'dead', last_error = $3
+WHERE id = $1 AND attempts = $2 AND status = 'pending'`
+
+	return r.update(ctx, query, msg.ID, msg.Attempts, lastError)
+}
+
+// Redrive method makes a dead message pending again with its attempts
+// reset. ErrEditConflict is returned when the message is not dead.
+func (r *outboxRepository) Redrive(ctx context.Context, msg *OutboxMessage) error {
+	query := `UPDATE email_outbox
+SET status = 'pending', attempts = 0, next_attempt_at = now()
+WHERE id = $1 AND status = 'dead'
+RETURNING status, attempts, next_attempt_at`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, msg.ID).Scan(&msg.Status, &msg.Attempts, &msg.NextAttemptAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get method returns a message of the outbox.
+func (r *outboxRepository) Get(ctx context.Context, id int64) (*OutboxMessage, error) {
+	query := `SELECT ` + outboxColumns + `
+FROM email_outbox
+WHERE id = $1`
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := scanOutboxMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return messages[0], nil
+}
+
+// GetAll method returns the messages matching the filter and the cursor
+// for the next page, which is zero when there are no more messages.
+func (r *outboxRepository) GetAll(ctx context.Context, filter OutboxFilter) ([]*OutboxMessage, int64, error) {
+	query := `SELECT ` + outboxColumns + `
+FROM email_outbox
+WHERE (status = $1 OR $1 = '')
+AND (id < $2 OR $2 = 0)
+ORDER BY id DESC
+LIMIT $3`
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, filter.Status, filter.Cursor, filter.Limit+1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	messages, err := scanOutboxMessages(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var next int64
+
+	if len(messages) > filter.Limit {
+		messages = messages[:filter.Limit]
+		next = messages[len(messages)-1].ID
+	}
+
+	return messages, next, nil
+}
+
+// DeleteSent method removes the messages sent before the given time.
+func (r *outboxRepository) DeleteSent(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM email_outbox
+WHERE status = 'sent' AND sent_at < $1`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (r *outboxRepository) update(ctx context.Context, query string, args ...interface{}) error {
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func scanOutboxMessages(rows *sql.Rows) ([]*OutboxMessage, error) {
+	defer rows.Close()
+
+	messages := []*OutboxMessage{}
+
+	for rows.Next() {
+		var (
+			msg  OutboxMessage
+			data []byte
+		)
+
+		err := rows.Scan(
+			&msg.ID,
+			&msg.CreatedAt,
+			&msg.Recipient,
+			&msg.Template,
+			&data,
+			&msg.Status,
+			&msg.Attempts,
+			&msg.NextAttemptAt,
+			&msg.LastError,
+			&msg.SentAt,
+			&msg.RequestID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.Data = data
+
+		messages = append(messages, &msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
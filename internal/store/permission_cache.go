@@ -0,0 +1,204 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PermissionCache keeps the permission codes of users in memory for a
+// limited time, so permission checks do not hit the database on every
+// request. The repositories invalidate the affected entries whenever
+// permissions or roles change through them, or once the transaction of the
+// change commits. Changes made by another process become visible once the
+// entry expires.
+type PermissionCache struct {
+	hits   uint64
+	misses uint64
+	ttl    time.Duration
+	mu     sync.RWMutex
+	// generation is incremented by every invalidation, so a lookup which
+	// read the permissions before a change does not cache them after it.
+	generation uint64
+	entries    map[int64]permissionCacheEntry
+}
+
+// permissionCacher is the permission cache used by the repositories, which
+// is a *PermissionCache or, in a transaction, a *txPermissionCache.
+type permissionCacher interface {
+	get(userID int64) (Permissions, uint64, bool)
+	set(userID int64, permissions Permissions, generation uint64)
+	Invalidate(userIDs ...int64)
+	InvalidateAll()
+}
+
+type permissionCacheEntry struct {
+	permissions Permissions
+	expiry      time.Time
+}
+
+// PermissionCacheStats is a snapshot of the cache counters.
+type PermissionCacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// NewPermissionCache returns a cache which keeps entries for the given ttl.
+// A nil cache is valid and never caches anything.
+func NewPermissionCache(ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		ttl:     ttl,
+		entries: make(map[int64]permissionCacheEntry),
+	}
+}
+
+// get returns the cached permissions of the user or, when they are not
+// cached, the generation to pass to set once they are read.
+func (c *PermissionCache) get(userID int64) (Permissions, uint64, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+
+	c.mu.RLock()
+	entry, found := c.entries[userID]
+	generation := c.generation
+	c.mu.RUnlock()
+
+	if !found || time.Now().After(entry.expiry) {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, generation, false
+	}
+
+	atomic.AddUint64(&c.hits, 1)
+	return entry.permissions, generation, true
+}
+
+// set caches the permissions of the user unless an invalidation happened
+// since get returned generation.
+func (c *PermissionCache) set(userID int64, permissions Permissions, generation uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		return
+	}
+
+	c.entries[userID] = permissionCacheEntry{
+		permissions: permissions,
+		expiry:      time.Now().Add(c.ttl),
+	}
+}
+
+// Invalidate removes the cached permissions of the given users.
+func (c *PermissionCache) Invalidate(userIDs ...int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.generation++
+	for _, id := range userIDs {
+		delete(c.entries, id)
+	}
+	c.mu.Unlock()
+}
+
+// InvalidateAll removes every cached entry.
+func (c *PermissionCache) InvalidateAll() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.generation++
+	c.entries = make(map[int64]permissionCacheEntry)
+	c.mu.Unlock()
+}
+
+// DeleteExpired removes the entries whose ttl has passed.
+func (c *PermissionCache) DeleteExpired() {
+	if c == nil {
+		return
+	}
+
+	now := time.Now()
+
+	c.mu.Lock()
+	for id, entry := range c.entries {
+		if now.After(entry.expiry) {
+			delete(c.entries, id)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Stats returns the current hit and miss counters and the number of entries.
+func (c *PermissionCache) Stats() PermissionCacheStats {
+	if c == nil {
+		return PermissionCacheStats{}
+	}
+
+	c.mu.RLock()
+	entries := len(c.entries)
+	c.mu.RUnlock()
+
+	return PermissionCacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: entries,
+	}
+}
+
+// txPermissionCache is the permission cache of a transaction. It caches
+// nothing and keeps the invalidations until the commit, so neither the
+// uncommitted nor the rolled back changes reach the shared cache.
+type txPermissionCache struct {
+	parent  *PermissionCache
+	mu      sync.Mutex
+	userIDs []int64
+	all     bool
+}
+
+// begin returns the cache of a transaction, whose invalidations are applied
+// to c by commit.
+func (c *PermissionCache) begin() *txPermissionCache {
+	return &txPermissionCache{parent: c}
+}
+
+func (c *txPermissionCache) get(userID int64) (Permissions, uint64, bool) {
+	return nil, 0, false
+}
+
+func (c *txPermissionCache) set(userID int64, permissions Permissions, generation uint64) {}
+
+func (c *txPermissionCache) Invalidate(userIDs ...int64) {
+	c.mu.Lock()
+	c.userIDs = append(c.userIDs, userIDs...)
+	c.mu.Unlock()
+}
+
+func (c *txPermissionCache) InvalidateAll() {
+	c.mu.Lock()
+	c.all = true
+	c.mu.Unlock()
+}
+
+// commit applies the invalidations of the committed transaction.
+func (c *txPermissionCache) commit() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.all {
+		c.parent.InvalidateAll()
+		return
+	}
+
+	if len(c.userIDs) > 0 {
+		c.parent.Invalidate(c.userIDs...)
+	}
+}
@@ -2,40 +2,163 @@ package store
 
 import (
 	"context"
-	"database/sql"
 	"github.com/lib/pq"
-	"time"
+	"strings"
 )
 
+// Permission is a single permission code which can be granted to users.
+type Permission struct {
+	ID   int64  `json:"id"`
+	Code string `json:"code"`
+}
+
 // Permissions slice will hold the permission codes.
+//
+// A permission code is made of segments separated by a colon, for example
+// "posts:read". Besides plain codes the slice may hold patterns and deny
+// entries:
+//
+//   - A "*" segment matches exactly one segment, unless it is the last
+//     segment of the pattern, in which case it matches one or more
+//     remaining segments. So "posts:*" matches "posts:read" and
+//     "posts:comments:write", "*:read" matches "posts:read" and "*"
+//     matches every code.
+//   - A code prefixed with "!" is a deny entry, for example "!posts:write"
+//     or "!posts:*".
 type Permissions []string
 
-// Include method checks the Permissions slice whether it contains
-// a specific permission code or not.
+// Include method checks whether the Permissions slice allows
+// a specific permission code. The resolution order is:
+//
+//  1. If any deny entry matches the code, the code is not allowed,
+//     regardless of any grant.
+//  2. Otherwise, if any grant (plain code or pattern) matches the code,
+//     the code is allowed.
+//  3. Otherwise the code is not allowed.
 func (p Permissions) Include(code string) bool {
+	allowed := false
+
 	for i := range p {
-		if code == p[i] {
-			return true
+		if strings.HasPrefix(p[i], denyPrefix) {
+			if matchPermission(strings.TrimPrefix(p[i], denyPrefix), code) {
+				return false
+			}
+			continue
+		}
+
+		if !allowed && matchPermission(p[i], code) {
+			allowed = true
+		}
+	}
+
+	return allowed
+}
+
+// Covers method reports whether p allows everything other allows: every
+// grant of other has to be included in p, and no code denied by p may be
+// allowed by other. The patterns of other are checked as codes, so the
+// result errs on the side of false.
+func (p Permissions) Covers(other Permissions) bool {
+	for _, code := range other {
+		if !strings.HasPrefix(code, denyPrefix) && !p.Include(code) {
+			return false
+		}
+	}
+
+	for _, code := range p {
+		if strings.HasPrefix(code, denyPrefix) && other.Include(strings.TrimPrefix(code, denyPrefix)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+const (
+	denyPrefix       = "!"
+	wildcardSegment  = "*"
+	segmentSeparator = ":"
+)
+
+// matchPermission reports whether the pattern matches the permission code.
+func matchPermission(pattern, code string) bool {
+	if pattern == code {
+		return true
+	}
+
+	patternSegments := strings.Split(pattern, segmentSeparator)
+	codeSegments := strings.Split(code, segmentSeparator)
+
+	for i, segment := range patternSegments {
+		if i >= len(codeSegments) {
+			return false
+		}
+
+		if segment == wildcardSegment {
+			if i == len(patternSegments)-1 {
+				return true
+			}
+			continue
+		}
+
+		if segment != codeSegments[i] {
+			return false
+		}
+	}
+
+	return len(patternSegments) == len(codeSegments)
+}
+
+// ValidPermissionCode reports whether the code is a well formed permission
+// code, pattern or deny entry.
+func ValidPermissionCode(code string) bool {
+	code = strings.TrimPrefix(code, denyPrefix)
+	if code == "" {
+		return false
+	}
+
+	for _, segment := range strings.Split(code, segmentSeparator) {
+		if segment == "" || strings.ContainsAny(segment, " \t\n"+denyPrefix) {
+			return false
+		}
+
+		if segment != wildcardSegment && strings.Contains(segment, wildcardSegment) {
+			return false
 		}
 	}
 
-	return false
+	return true
 }
 
 type permissionRepository struct {
-	DB *sql.DB
+	DB       dbtx
+	timeouts Timeouts
+	cache    permissionCacher
 }
 
 // GetAllForUser method returns all permission codes for a specific user
-// in a Permissions slice.
-func (r *permissionRepository) GetAllForUser(userID int64) (Permissions, error) {
+// in a Permissions slice. The result is the union of the codes granted
+// directly to the user and the codes of every role assigned to the user.
+// The result is served from the permission cache when possible.
+func (r *permissionRepository) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	permissions, generation, found := r.cache.get(userID)
+	if found {
+		return permissions, nil
+	}
+
 	query := `SELECT permissions.code
 FROM permissions
 INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-INNER JOIN users ON users_permissions.user_id = users.id
-WHERE users.id = $1`
+WHERE users_permissions.user_id = $1
+UNION
+SELECT permissions.code
+FROM permissions
+INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+WHERE users_roles.user_id = $1
+ORDER BY code`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := r.timeouts.read(ctx)
 	defer cancel()
 
 	rows, err := r.DB.QueryContext(ctx, query, userID)
@@ -43,7 +166,7 @@ WHERE users.id = $1`
 		return nil, err
 	}
 
-	var permissions Permissions
+	defer rows.Close()
 
 	for rows.Next() {
 		var permission string
@@ -58,17 +181,103 @@ WHERE users.id = $1`
 		return nil, err
 	}
 
+	r.cache.set(userID, permissions, generation)
+
 	return permissions, nil
 }
 
 // AddForUser adds the provided permission codes for a specific user.
-func (r *permissionRepository) AddForUser(userID int64, codes ...string) error {
+// Codes which are already granted to the user are skipped.
+func (r *permissionRepository) AddForUser(ctx context.Context, userID int64, codes ...string) error {
 	query := `INSERT INTO users_permissions
-SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+ON CONFLICT DO NOTHING`
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := r.timeouts.write(ctx)
 	defer cancel()
 
 	_, err := r.DB.ExecContext(ctx, query, userID, pq.Array(codes))
-	return err
-}
\ No newline at end of file
+	if err != nil {
+		return err
+	}
+
+	r.cache.Invalidate(userID)
+
+	return nil
+}
+
+// RemoveForUser revokes the provided permission codes from a specific user.
+func (r *permissionRepository) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `DELETE FROM users_permissions
+USING permissions
+WHERE users_permissions.permission_id = permissions.id
+AND users_permissions.user_id = $1 AND permissions.code = ANY($2)`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	r.cache.Invalidate(userID)
+
+	return nil
+}
+
+// GetAll method returns every permission code known by the application.
+func (r *permissionRepository) GetAll(ctx context.Context) ([]*Permission, error) {
+	query := `SELECT id, code
+FROM permissions
+ORDER BY code ASC`
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	permissions := []*Permission{}
+
+	for rows.Next() {
+		var permission Permission
+
+		if err := rows.Scan(&permission.ID, &permission.Code); err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, &permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Insert method creates a new permission code.
+func (r *permissionRepository) Insert(ctx context.Context, permission *Permission) error {
+	query := `INSERT INTO permissions (code)
+VALUES ($1)
+RETURNING id`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, permission.Code).Scan(&permission.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "permissions_code_key"`:
+			return ErrDuplicatePermission
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
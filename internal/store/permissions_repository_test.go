@@ -0,0 +1,66 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestPermissionsInclude(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions Permissions
+		code        string
+		want        bool
+	}{
+		{"exact", Permissions{"posts:read"}, "posts:read", true},
+		{"missing", Permissions{"posts:read"}, "posts:write", false},
+		{"empty", Permissions{}, "posts:read", false},
+		{"wildcard", Permissions{"*"}, "users:impersonate", true},
+		{"trailing wildcard", Permissions{"posts:*"}, "posts:write", true},
+		{"trailing wildcard other resource", Permissions{"posts:*"}, "users:read", false},
+		{"trailing wildcard nested", Permissions{"posts:*"}, "posts:comments:write", true},
+		{"middle wildcard", Permissions{"posts:*:read"}, "posts:comments:read", true},
+		{"middle wildcard other action", Permissions{"posts:*:read"}, "posts:comments:write", false},
+		{"middle wildcard shorter code", Permissions{"posts:*:read"}, "posts:read", false},
+		{"longer code", Permissions{"posts"}, "posts:read", false},
+		{"deny", Permissions{"*", "!users:impersonate"}, "users:impersonate", false},
+		{"deny before grant", Permissions{"!posts:write", "posts:*"}, "posts:write", false},
+		{"deny other code", Permissions{"*", "!users:impersonate"}, "posts:write", true},
+		{"deny wildcard", Permissions{"*", "!posts:*"}, "posts:read", false},
+		{"deny alone", Permissions{"!posts:write"}, "posts:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.permissions.Include(tt.code); got != tt.want {
+				t.Errorf("%v.Include(%q) = %v, want %v", tt.permissions, tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermissionsCovers(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions Permissions
+		other       Permissions
+		want        bool
+	}{
+		{"same", Permissions{"posts:read"}, Permissions{"posts:read"}, true},
+		{"subset", Permissions{"posts:read", "posts:write"}, Permissions{"posts:read"}, true},
+		{"superset", Permissions{"posts:read"}, Permissions{"posts:read", "posts:write"}, false},
+		{"empty", Permissions{"posts:read"}, Permissions{}, true},
+		{"wildcard", Permissions{"*"}, Permissions{"users:impersonate", "posts:*"}, true},
+		{"narrower wildcard", Permissions{"posts:*"}, Permissions{"*"}, false},
+		{"deny of other", Permissions{"posts:read"}, Permissions{"posts:read", "!posts:write"}, true},
+		{"denied to covering", Permissions{"*", "!users:impersonate"}, Permissions{"users:impersonate"}, false},
+		{"denied to covering by wildcard", Permissions{"*", "!posts:write"}, Permissions{"posts:*"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.permissions.Covers(tt.other); got != tt.want {
+				t.Errorf("%v.Covers(%v) = %v, want %v", tt.permissions, tt.other, got, tt.want)
+			}
+		})
+	}
+}
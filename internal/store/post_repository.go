@@ -12,49 +12,62 @@ import (
 type Post struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"-"`
+	UserID    int64     `json:"user_id,omitempty"`
 	Title     string    `json:"title"`
 	Body      string    `json:"body"`
 	Tags      []string  `json:"tags,omitempty"`
+	Private   bool      `json:"private"`
 	Version   int32     `json:"version"`
 }
 
+// PostAccess describes which posts a caller is allowed to list.
+// Unless All is set, private posts are only visible to their owner
+// and to the users granted access through an ACL entry.
+type PostAccess struct {
+	UserID int64
+	All    bool
+}
+
 type postRepository struct {
-	DB *sql.DB
+	DB       dbtx
+	timeouts Timeouts
 }
 
-func (r *postRepository) Insert(post *Post) error {
-	query := `INSERT INTO posts (title, body, tags) 
-VALUES ($1, $2, $3) 
+func (r *postRepository) Insert(ctx context.Context, post *Post) error {
+	query := `INSERT INTO posts (user_id, title, body, tags, private)
+VALUES (NULLIF($1::bigint, 0), $2, $3, $4, $5)
 RETURNING id, created_at, version`
 
-	args := []interface{}{post.Title, post.Body, pq.Array(post.Tags)}
+	args := []interface{}{post.UserID, post.Title, post.Body, pq.Array(post.Tags), post.Private}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := r.timeouts.write(ctx)
 	defer cancel()
 
 	return r.DB.QueryRowContext(ctx, query, args...).Scan(&post.ID, &post.CreatedAt, &post.Version)
 }
 
-func (r *postRepository) Get(id int64) (*Post, error) {
+func (r *postRepository) Get(ctx context.Context, id int64) (*Post, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT id, created_at, title, body, tags, version
+	query := `SELECT id, created_at, COALESCE(user_id, 0), title, body, tags, private, version
 FROM posts
 WHERE id = $1`
 
 	var post Post
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := r.timeouts.read(ctx)
 	defer cancel()
 
 	err := r.DB.QueryRowContext(ctx, query, id).Scan(
 		&post.ID,
 		&post.CreatedAt,
+		&post.UserID,
 		&post.Title,
 		&post.Body,
 		pq.Array(&post.Tags),
+		&post.Private,
 		&post.Version,
 	)
 
@@ -70,20 +83,21 @@ WHERE id = $1`
 	return &post, nil
 }
 
-func (r *postRepository) Update(post *Post) error {
-	query := `UPDATE posts SET title=$1, body=$2, tags=$3, version= version + 1
-WHERE id=$4 AND version = $5
+func (r *postRepository) Update(ctx context.Context, post *Post) error {
+	query := `UPDATE posts SET title=$1, body=$2, tags=$3, private=$4, version= version + 1
+WHERE id=$5 AND version = $6
 RETURNING version`
 
 	args := []interface{}{
 		post.Title,
 		post.Body,
 		pq.Array(post.Tags),
+		post.Private,
 		post.ID,
 		post.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := r.timeouts.write(ctx)
 	defer cancel()
 
 	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&post.Version)
@@ -99,11 +113,16 @@ RETURNING version`
 	return nil
 }
 
-func (r *postRepository) Delete(id int64) error {
-	query := `DELETE FROM posts
+// Delete method removes a post with the ACL entries of the post.
+func (r *postRepository) Delete(ctx context.Context, id int64) error {
+	query := `WITH acl AS (
+    DELETE FROM acl_entries
+    WHERE resource_type = 'post' AND resource_id = $1
+)
+DELETE FROM posts
 WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := r.timeouts.write(ctx)
 	defer cancel()
 
 	result, err := r.DB.ExecContext(ctx, query, id)
@@ -123,18 +142,26 @@ WHERE id = $1`
 	return nil
 }
 
-func (r *postRepository) GetAll(title string, tags []string, filters Filters) ([]*Post, error) {
-	query := fmt.Sprintf(`SELECT id, created_at, title, tags, version
+// GetAll method returns the posts matching the title and tags
+// which are visible according to access.
+func (r *postRepository) GetAll(ctx context.Context, title string, tags []string, access PostAccess, filters Filters) ([]*Post, error) {
+	query := fmt.Sprintf(`SELECT id, created_at, COALESCE(user_id, 0), title, tags, private, version
 FROM posts
 WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 AND (tags @> $2 OR $2 = '{}')
+AND ($5 OR NOT private OR user_id = $6 OR EXISTS (
+	SELECT 1 FROM acl_entries
+	WHERE resource_type = 'post' AND (resource_id = posts.id OR resource_id IS NULL)
+	AND action IN ('read', 'write')
+	AND ((subject_type = 'user' AND subject_id = $6)
+	OR (subject_type = 'role' AND subject_id IN (SELECT role_id FROM users_roles WHERE user_id = $6)))))
 ORDER BY %s %s, id ASC
 LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := r.timeouts.read(ctx)
 	defer cancel()
 
-	args := []interface{}{title, pq.Array(tags), filters.Limit, filters.offset()}
+	args := []interface{}{title, pq.Array(tags), filters.Limit, filters.offset(), access.All, access.UserID}
 
 	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -151,8 +178,10 @@ LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 		err := rows.Scan(
 			&post.ID,
 			&post.CreatedAt,
+			&post.UserID,
 			&post.Title,
 			pq.Array(&post.Tags),
+			&post.Private,
 			&post.Version,
 		)
 		if err != nil {
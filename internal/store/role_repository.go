@@ -0,0 +1,226 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+)
+
+// Role bundles a set of permission codes under a name
+// so they can be assigned to users together.
+type Role struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type roleRepository struct {
+	DB       dbtx
+	timeouts Timeouts
+	cache    permissionCacher
+}
+
+// GetAll method returns every role with its permission codes.
+func (r *roleRepository) GetAll(ctx context.Context) ([]*Role, error) {
+	query := `SELECT roles.id, roles.name,
+COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+FROM roles
+LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+LEFT JOIN permissions ON roles_permissions.permission_id = permissions.id
+GROUP BY roles.id
+ORDER BY roles.name ASC`
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	roles := []*Role{}
+
+	for rows.Next() {
+		var role Role
+
+		if err := rows.Scan(&role.ID, &role.Name, pq.Array((*[]string)(&role.Permissions))); err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, &role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetByName method returns a single role with its permission codes.
+func (r *roleRepository) GetByName(ctx context.Context, name string) (*Role, error) {
+	query := `SELECT roles.id, roles.name,
+COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+FROM roles
+LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+LEFT JOIN permissions ON roles_permissions.permission_id = permissions.id
+WHERE roles.name = $1
+GROUP BY roles.id`
+
+	var role Role
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, name).Scan(&role.ID, &role.Name, pq.Array((*[]string)(&role.Permissions)))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &role, nil
+}
+
+// Insert method creates a new role. The permission codes of the role
+// are not stored, use AddPermissions for that.
+func (r *roleRepository) Insert(ctx context.Context, role *Role) error {
+	query := `INSERT INTO roles (name)
+VALUES ($1)
+RETURNING id`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, role.Name).Scan(&role.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_name_key"`:
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddPermissions adds the provided permission codes to a role.
+func (r *roleRepository) AddPermissions(ctx context.Context, roleID int64, codes ...string) error {
+	query := `INSERT INTO roles_permissions
+SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+ON CONFLICT DO NOTHING`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, roleID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	r.cache.InvalidateAll()
+
+	return nil
+}
+
+// RemovePermissions removes the provided permission codes from a role.
+func (r *roleRepository) RemovePermissions(ctx context.Context, roleID int64, codes ...string) error {
+	query := `DELETE FROM roles_permissions
+USING permissions
+WHERE roles_permissions.permission_id = permissions.id
+AND roles_permissions.role_id = $1 AND permissions.code = ANY($2)`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, roleID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	r.cache.InvalidateAll()
+
+	return nil
+}
+
+// GetAllForUser method returns the names of the roles assigned to a user.
+func (r *roleRepository) GetAllForUser(ctx context.Context, userID int64) ([]string, error) {
+	query := `SELECT roles.name
+FROM roles
+INNER JOIN users_roles ON users_roles.role_id = roles.id
+WHERE users_roles.user_id = $1
+ORDER BY roles.name ASC`
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	roles := []string{}
+
+	for rows.Next() {
+		var role string
+
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// AddForUser assigns the provided roles to a specific user.
+// Roles which are already assigned to the user are skipped.
+func (r *roleRepository) AddForUser(ctx context.Context, userID int64, names ...string) error {
+	query := `INSERT INTO users_roles
+SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+ON CONFLICT DO NOTHING`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	if err != nil {
+		return err
+	}
+
+	r.cache.Invalidate(userID)
+
+	return nil
+}
+
+// RemoveForUser unassigns the provided roles from a specific user.
+func (r *roleRepository) RemoveForUser(ctx context.Context, userID int64, names ...string) error {
+	query := `DELETE FROM users_roles
+USING roles
+WHERE users_roles.role_id = roles.id
+AND users_roles.user_id = $1 AND roles.name = ANY($2)`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	if err != nil {
+		return err
+	}
+
+	r.cache.Invalidate(userID)
+
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
-	"database/sql"
 	"encoding/base32"
 	"time"
 )
@@ -12,14 +11,16 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeImpersonation  = "impersonation"
 )
 
 type Token struct {
-	Plaintext string    `json:"token"`
-	Hash      []byte    `json:"-"`
-	UserID    int64     `json:"-"`
-	Expiry    time.Time `json:"expiry"`
-	Scope     string    `json:"-"`
+	Plaintext      string    `json:"token"`
+	Hash           []byte    `json:"-"`
+	UserID         int64     `json:"-"`
+	Expiry         time.Time `json:"expiry"`
+	Scope          string    `json:"-"`
+	ImpersonatorID int64     `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -29,56 +30,103 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 		Scope:  scope,
 	}
 
+	plaintext, hash, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = plaintext
+	token.Hash = hash
+
+	return token, nil
+}
+
+// randomToken returns a random 26 character plaintext token with its SHA-256 hash.
+func randomToken() (string, []byte, error) {
 	randomBytes := make([]byte, 16)
 
 	_, err := rand.Read(randomBytes)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
-	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
-
-	hash := sha256.Sum256([]byte(token.Plaintext))
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
 
-	token.Hash = hash[:]
+	return plaintext, hashToken(plaintext), nil
+}
 
-	return token, nil
+// hashToken returns the SHA-256 hash under which a token is stored.
+func hashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
 }
 
 type tokenRepository struct {
-	DB *sql.DB
+	DB       dbtx
+	timeouts Timeouts
 }
 
-func (r *tokenRepository) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+func (r *tokenRepository) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
 
-	err = r.Insert(token)
+	err = r.Insert(ctx, token)
 	return token, err
 }
 
-func (r *tokenRepository) Insert(token *Token) error {
-	query := `INSERT INTO tokens (hash, user_id, expiry, scope)
-VALUES ($1, $2, $3, $4)`
+// NewImpersonation creates a token which authenticates as the user while
+// recording the impersonator as the one who is actually acting.
+func (r *tokenRepository) NewImpersonation(ctx context.Context, userID, impersonatorID int64, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeImpersonation)
+	if err != nil {
+		return nil, err
+	}
 
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+	token.ImpersonatorID = impersonatorID
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = r.Insert(ctx, token)
+	return token, err
+}
+
+func (r *tokenRepository) Insert(ctx context.Context, token *Token) error {
+	query := `INSERT INTO tokens (hash, user_id, expiry, scope, impersonator_id)
+VALUES ($1, $2, $3, $4, NULLIF($5::bigint, 0))`
+
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.ImpersonatorID}
+
+	ctx, cancel := r.timeouts.write(ctx)
 	defer cancel()
 
 	_, err := r.DB.ExecContext(ctx, query, args...)
 	return err
 }
 
-func (r *tokenRepository) DeleteAllForUser(scope string, userID int64) error {
+func (r *tokenRepository) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
 	query := `DELETE FROM tokens
 WHERE scope = $1 AND user_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := r.timeouts.write(ctx)
 	defer cancel()
 
 	_, err := r.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteExpired method deletes the expired tokens of every scope
+// and returns the number of deleted tokens.
+func (r *tokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM tokens
+WHERE expiry < NOW()`
+
+	ctx, cancel := r.timeouts.write(ctx)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxTxAttempts is the number of times a transaction is run
+// before a serialization failure is returned to the caller.
+const maxTxAttempts = 3
+
+// dbtx is the subset of *sql.DB and *sql.Tx used by the repositories,
+// so the same repositories can run inside and outside a transaction.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func runTx(ctx context.Context, db *sql.DB, timeouts Timeouts, permissionCache *PermissionCache, fn func(Models) error) error {
+	for attempt := 1; ; attempt++ {
+		err := runTxOnce(ctx, attempt, db, timeouts, permissionCache, fn)
+		if err == nil || attempt == maxTxAttempts || !isSerializationFailure(err) {
+			return err
+		}
+	}
+}
+
+func runTxOnce(ctx context.Context, attempt int, db *sql.DB, timeouts Timeouts, permissionCache *PermissionCache, fn func(Models) error) (err error) {
+	ctx, span := tracer.Start(ctx, "db transaction", trace.WithAttributes(
+		semconv.DBSystemPostgreSQL,
+		attribute.Int("db.transaction.attempt", attempt),
+	))
+	defer span.End()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+
+		if err != nil {
+			recordSpanError(span, err)
+			tx.Rollback()
+		}
+	}()
+
+	// The repositories of the transaction must not cache uncommitted
+	// permissions, their invalidations are applied once it commits.
+	txCache := permissionCache.begin()
+
+	models := newSQLModels(tx, timeouts, txCache)
+	models.withTx = func(ctx context.Context, fn func(Models) error) error {
+		return fn(models)
+	}
+
+	if err := fn(models); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	txCache.commit()
+
+	return nil
+}
+
+// isSerializationFailure reports whether err is a serialization failure
+// or a deadlock, after which the transaction can safely be retried.
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
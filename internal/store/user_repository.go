@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"github.com/lib/pq"
 	"github.com/nebisin/api_structure/pkg/auth"
 	"time"
 )
@@ -19,6 +20,10 @@ type User struct {
 	Password  auth.Password `json:"-"`
 	Activated bool          `json:"activated"`
 	Version   int           `json:"-"`
+
+	// Impersonator is the user who is acting on behalf of this user
+	// when the request is authenticated with an impersonation token.
+	Impersonator *User `json:"-"`
 }
 
 func (u *User) IsAnonymous() bool {
@@ -26,17 +31,18 @@ func (u *User) IsAnonymous() bool {
 }
 
 type userRepository struct {
-	DB *sql.DB
+	DB       dbtx
+	timeouts Timeouts
 }
 
-func (r *userRepository) Insert(user *User) error {
+func (r *userRepository) Insert(ctx context.Context, user *User) error {
 	query := `INSERT INTO users (name, email, password_hash, activated)
 VALUES ($1, $2, $3, $4)
 RETURNING id, created_at, version`
 
 	args := []interface{}{user.Name, user.Email, user.Password.Hash, user.Activated}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := r.timeouts.write(ctx)
 	defer cancel()
 
 	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
@@ -52,14 +58,50 @@ RETURNING id, created_at, version`
 	return nil
 }
 
-func (r *userRepository) GetByEmail(email string) (*User, error) {
+func (r *userRepository) Get(ctx context.Context, id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT id, created_at, name, email, password_hash, activated, version
+FROM users
+WHERE id = $1`
+
+	var user User
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.Hash,
+		&user.Activated,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `SELECT id, created_at, name, email, password_hash, activated, version
 FROM users
 WHERE email = $1`
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := r.timeouts.read(ctx)
 	defer cancel()
 
 	err := r.DB.QueryRowContext(ctx, query, email).Scan(
@@ -84,7 +126,7 @@ WHERE email = $1`
 	return &user, nil
 }
 
-func (r *userRepository) Update(user *User) error {
+func (r *userRepository) Update(ctx context.Context, user *User) error {
 	query := `UPDATE users
 SET name = $1, email = $2, password_hash=$3, activated=$4, version=version+1
 WHERE id = $5 AND version = $6
@@ -99,7 +141,7 @@ RETURNING version`
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := r.timeouts.write(ctx)
 	defer cancel()
 
 	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
@@ -117,7 +159,7 @@ RETURNING version`
 	return nil
 }
 
-func (r *userRepository) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+func (r *userRepository) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
@@ -131,7 +173,7 @@ WHERE tokens.hash = $1 AND tokens.scope = $2 AND tokens.expiry > $3`
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := r.timeouts.read(ctx)
 	defer cancel()
 
 	err := r.DB.QueryRowContext(ctx, query, args...).Scan(
@@ -154,3 +196,51 @@ WHERE tokens.hash = $1 AND tokens.scope = $2 AND tokens.expiry > $3`
 
 	return &user, nil
 }
+
+// GetForAuthentication returns the user of an authentication or
+// impersonation token together with the id of the impersonator,
+// which is zero for regular authentication tokens.
+func (r *userRepository) GetForAuthentication(ctx context.Context, tokenPlaintext string) (*User, int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version,
+COALESCE(tokens.impersonator_id, 0)
+FROM users
+INNER JOIN tokens
+ON users.id = tokens.user_id
+WHERE tokens.hash = $1 AND tokens.scope = ANY($2) AND tokens.expiry > $3`
+
+	scopes := []string{ScopeAuthentication, ScopeImpersonation}
+
+	args := []interface{}{tokenHash[:], pq.Array(scopes), time.Now()}
+
+	var (
+		user           User
+		impersonatorID int64
+	)
+
+	ctx, cancel := r.timeouts.read(ctx)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.Hash,
+		&user.Activated,
+		&user.Version,
+		&impersonatorID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, 0, ErrRecordNotFound
+		default:
+			return nil, 0, err
+		}
+	}
+
+	return &user, impersonatorID, nil
+}
@@ -0,0 +1,83 @@
+// Package tracing sets up the OpenTelemetry tracer provider of the server.
+//
+// The spans are exported to stdout, which is meant for development, or to
+// an OTLP collector over HTTP, and the W3C trace context is propagated.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"os"
+	"time"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Options configures Setup.
+type Options struct {
+	ServiceName    string
+	ServiceVersion string
+	// Exporter is one of ExporterNone, ExporterStdout and ExporterOTLP.
+	Exporter string
+	// Endpoint is the URL of the OTLP/HTTP traces endpoint of the collector.
+	Endpoint string
+	// SampleRatio is the ratio of the traces started by the server which
+	// are sampled. The sampling decision of the caller is followed.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes the pending spans and must be called on shutdown.
+func Setup(opts Options) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		e, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	case ExporterOTLP:
+		e, err := otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(opts.Endpoint),
+			otlptracehttp.WithTimeout(10*time.Second),
+		)
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+
+	res := resource.NewSchemaless(
+		semconv.ServiceName(opts.ServiceName),
+		semconv.ServiceVersion(opts.ServiceVersion),
+	)
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetupOTLP(t *testing.T) {
+	requests := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("export to %s with %q, want /v1/traces with application/x-protobuf", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+
+		var req coltracepb.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			t.Errorf("decoding the export request: %v", err)
+		}
+
+		requests <- &req
+	}))
+	defer collector.Close()
+
+	shutdown, err := Setup(Options{
+		ServiceName:    "api",
+		ServiceVersion: "1.0.0",
+		Exporter:       ExporterOTLP,
+		Endpoint:       collector.URL + "/v1/traces",
+		SampleRatio:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "GET /api/v1/posts")
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+
+	resourceSpans := req.GetResourceSpans()
+	if len(resourceSpans) != 1 {
+		t.Fatalf("exported %d resources, want 1", len(resourceSpans))
+	}
+
+	var service string
+	for _, attr := range resourceSpans[0].GetResource().GetAttributes() {
+		if attr.GetKey() == "service.name" {
+			service = attr.GetValue().GetStringValue()
+		}
+	}
+
+	if service != "api" {
+		t.Errorf("service.name = %q, want %q", service, "api")
+	}
+
+	scopeSpans := resourceSpans[0].GetScopeSpans()
+	if len(scopeSpans) != 1 || len(scopeSpans[0].GetSpans()) != 1 {
+		t.Fatalf("exported %v, want a single span", scopeSpans)
+	}
+
+	if name := scopeSpans[0].GetSpans()[0].GetName(); name != "GET /api/v1/posts" {
+		t.Errorf("span name = %q, want %q", name, "GET /api/v1/posts")
+	}
+}
+
+func TestSetupExporters(t *testing.T) {
+	tests := []struct {
+		exporter string
+		wantErr  bool
+	}{
+		{exporter: ExporterNone},
+		{exporter: ExporterStdout},
+		{exporter: "jaeger", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.exporter, func(t *testing.T) {
+			shutdown, err := Setup(Options{ServiceName: "api", Exporter: tt.exporter, SampleRatio: 1})
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Setup() succeeded, want an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := shutdown(context.Background()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    name text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name)
+VALUES ('reader'),
+       ('author'),
+       ('editor'),
+       ('admin')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON
+    (roles.name = 'reader' AND permissions.code = 'posts:read') OR
+    (roles.name = 'author' AND permissions.code IN ('posts:read', 'posts:write')) OR
+    (roles.name = 'editor' AND permissions.code IN ('posts:read', 'posts:write', 'permissions:read')) OR
+    (roles.name = 'admin')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
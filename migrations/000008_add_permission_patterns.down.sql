@@ -0,0 +1 @@
+DELETE FROM permissions WHERE code IN ('*', 'posts:*');
\ No newline at end of file
@@ -0,0 +1,10 @@
+INSERT INTO permissions (code)
+VALUES ('*'),
+       ('posts:*')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON roles.name = 'admin' AND permissions.code = '*'
+ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,3 @@
+INSERT INTO permissions (code)
+VALUES ('metrics:read')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
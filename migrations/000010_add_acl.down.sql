@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code = 'posts:moderate';
+DROP TABLE IF EXISTS acl_entries;
+ALTER TABLE posts DROP COLUMN IF EXISTS private;
+ALTER TABLE posts DROP COLUMN IF EXISTS user_id;
\ No newline at end of file
@@ -0,0 +1,28 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users ON DELETE SET NULL;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS private bool NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS posts_user_id_idx ON posts (user_id);
+
+CREATE TABLE IF NOT EXISTS acl_entries (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    resource_type text NOT NULL,
+    resource_id bigint,
+    subject_type text NOT NULL,
+    subject_id bigint NOT NULL,
+    action text NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS acl_entries_unique_idx
+    ON acl_entries (resource_type, COALESCE(resource_id, 0), subject_type, subject_id, action);
+CREATE INDEX IF NOT EXISTS acl_entries_subject_idx ON acl_entries (subject_type, subject_id);
+
+INSERT INTO permissions (code)
+VALUES ('posts:moderate')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON roles.name = 'editor' AND permissions.code = 'posts:moderate'
+ON CONFLICT DO NOTHING;
\ No newline at end of file
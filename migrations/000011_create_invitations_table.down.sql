@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code IN ('invitations:read', 'invitations:write');
+DROP TABLE IF EXISTS invitations;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    hash bytea UNIQUE NOT NULL,
+    email text NOT NULL,
+    roles text[] NOT NULL DEFAULT '{}',
+    invited_by bigint REFERENCES users ON DELETE SET NULL,
+    expiry timestamp(0) with time zone NOT NULL,
+    accepted_at timestamp(0) with time zone
+);
+
+INSERT INTO permissions (code)
+VALUES ('invitations:read'),
+       ('invitations:write')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS impersonator_id bigint REFERENCES users ON DELETE CASCADE;
+
+INSERT INTO permissions (code)
+VALUES ('users:impersonate')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
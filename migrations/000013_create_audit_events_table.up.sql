@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    action text NOT NULL,
+    actor_id bigint,
+    impersonator_id bigint,
+    resource_type text NOT NULL DEFAULT '',
+    resource_id text NOT NULL DEFAULT '',
+    ip text NOT NULL DEFAULT '',
+    request_id text NOT NULL DEFAULT '',
+    before jsonb,
+    after jsonb,
+    metadata jsonb
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action);
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS audit_events_resource_idx ON audit_events (resource_type, resource_id);
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
+
+INSERT INTO permissions (code)
+VALUES ('audit:read')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
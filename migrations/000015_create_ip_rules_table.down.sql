@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code IN ('ip_rules:read', 'ip_rules:write');
+DROP TABLE IF EXISTS ip_rules;
\ No newline at end of file
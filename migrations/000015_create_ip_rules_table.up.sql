@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS ip_rules (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    path_prefix text NOT NULL,
+    action text NOT NULL,
+    cidr text NOT NULL,
+    comment text NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ip_rules_unique_idx ON ip_rules (path_prefix, action, cidr);
+
+INSERT INTO permissions (code)
+VALUES ('ip_rules:read'), ('ip_rules:write')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
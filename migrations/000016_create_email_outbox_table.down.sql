@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code IN ('outbox:read', 'outbox:write');
+DROP TABLE IF EXISTS email_outbox;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    recipient text NOT NULL,
+    template text NOT NULL,
+    data jsonb NOT NULL DEFAULT '{}',
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    last_error text NOT NULL DEFAULT '',
+    sent_at timestamp(0) with time zone,
+    request_id text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS email_outbox_pending_idx ON email_outbox (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS email_outbox_status_idx ON email_outbox (status, id);
+
+INSERT INTO permissions (code)
+VALUES ('outbox:read'), ('outbox:write')
+ON CONFLICT DO NOTHING;
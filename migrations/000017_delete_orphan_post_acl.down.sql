@@ -0,0 +1 @@
+-- The deleted orphan entries cannot be restored.
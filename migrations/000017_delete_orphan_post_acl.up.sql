@@ -0,0 +1,3 @@
+DELETE FROM acl_entries
+WHERE resource_type = 'post' AND resource_id IS NOT NULL
+AND NOT EXISTS (SELECT 1 FROM posts WHERE posts.id = acl_entries.resource_id);
@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations of the database schema,
+// so they are shipped inside the binary.
+package migrations
+
+import "embed"
+
+// FS holds the {version}_{title}.{up|down}.sql migration files.
+//
+//go:embed *.sql
+var FS embed.FS
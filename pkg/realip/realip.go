@@ -0,0 +1,203 @@
+// Package realip resolves the IP address of the client of a request which
+// reaches the server through reverse proxies.
+package realip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// Resolver resolves the client IP address of a request from the
+// forwarding headers set by the trusted proxies.
+//
+// The headers are only read when the request comes from a trusted proxy.
+// The addresses of the RFC 7239 Forwarded header, or of the
+// X-Forwarded-For header when there is none, are walked from the nearest
+// hop and the first one which is not a trusted proxy is the client. The
+// X-Real-IP header is used when the proxy sets neither.
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// NewResolver returns a Resolver trusting the proxies of the given CIDRs,
+// a single IP address being accepted as well.
+func NewResolver(proxies []string) (*Resolver, error) {
+	r := &Resolver{}
+
+	for _, proxy := range proxies {
+		network, err := ParseNetwork(proxy)
+		if err != nil {
+			return nil, err
+		}
+
+		r.trusted = append(r.trusted, network)
+	}
+
+	return r, nil
+}
+
+// ParseNetwork parses a CIDR, or a single IP address as the network made
+// of that address only.
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 8*net.IPv4len
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// ClientIP returns the IP address of the client of the request.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	remote := parseIP(req.RemoteAddr)
+	if remote == nil {
+		return req.RemoteAddr
+	}
+
+	if !r.isTrusted(remote) {
+		return remote.String()
+	}
+
+	hops := forwardedFor(req.Header.Values("Forwarded"))
+	if len(hops) == 0 {
+		hops = forwardedForList(req.Header.Values("X-Forwarded-For"))
+	}
+
+	if len(hops) == 0 {
+		if ip := parseIP(req.Header.Get("X-Real-IP")); ip != nil {
+			return ip.String()
+		}
+
+		return remote.String()
+	}
+
+	client := remote
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseIP(hops[i])
+		if ip == nil {
+			// An obfuscated or unknown hop hides the clients behind it.
+			break
+		}
+
+		client = ip
+
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewContext returns a copy of ctx carrying the client IP address.
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// FromContext returns the client IP address carried by ctx, if any.
+func FromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(contextKey{}).(string)
+	return ip
+}
+
+// forwardedFor returns the for parameters of the elements of the RFC 7239
+// Forwarded header values, in order.
+func forwardedFor(values []string) []string {
+	var hops []string
+
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			for _, pair := range splitQuoted(element, ';') {
+				name, value, found := cut(pair, "=")
+				if !found || !strings.EqualFold(strings.TrimSpace(name), "for") {
+					continue
+				}
+
+				hops = append(hops, strings.Trim(strings.TrimSpace(value), `"`))
+			}
+		}
+	}
+
+	return hops
+}
+
+// forwardedForList returns the addresses of the X-Forwarded-For header
+// values, in order.
+func forwardedForList(values []string) []string {
+	var hops []string
+
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	return hops
+}
+
+// parseIP parses an IP address, optionally with a port and with an IPv6
+// address in brackets.
+func parseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
+
+// splitQuoted splits s around sep, ignoring the separators in quoted strings.
+func splitQuoted(s string, sep rune) []string {
+	var parts []string
+
+	quoted, start := false, 0
+
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
+}
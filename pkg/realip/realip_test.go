@@ -0,0 +1,144 @@
+package realip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:   "direct",
+			remote: "203.0.113.7:51234",
+			want:   "203.0.113.7",
+		},
+		{
+			name:    "untrusted remote",
+			remote:  "203.0.113.7:51234",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "trusted proxy",
+			remote:  "10.0.0.2:51234",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "spoofed hop before the client",
+			remote:  "10.0.0.2:51234",
+			headers: map[string]string{"X-Forwarded-For": "192.0.2.66, 198.51.100.1"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "chain of trusted proxies",
+			remote:  "10.0.0.2:51234",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.3, 10.0.0.4"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "only trusted proxies",
+			remote:  "10.0.0.2:51234",
+			headers: map[string]string{"X-Forwarded-For": "10.0.0.3"},
+			want:    "10.0.0.3",
+		},
+		{
+			name:   "forwarded",
+			remote: "10.0.0.2:51234",
+			headers: map[string]string{
+				"Forwarded":       `for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"`,
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			want: "2001:db8::1",
+		},
+		{
+			name:    "forwarded obfuscated hop",
+			remote:  "10.0.0.2:51234",
+			headers: map[string]string{"Forwarded": "for=198.51.100.1, for=_hidden"},
+			want:    "10.0.0.2",
+		},
+		{
+			name:    "x-real-ip",
+			remote:  "10.0.0.2:51234",
+			headers: map[string]string{"X-Real-IP": "198.51.100.1"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "invalid x-real-ip",
+			remote:  "10.0.0.2:51234",
+			headers: map[string]string{"X-Real-IP": "unknown"},
+			want:    "10.0.0.2",
+		},
+		{
+			name:    "trusted single address",
+			remote:  "[2001:db8::5]:443",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:   "invalid remote",
+			remote: "pipe",
+			want:   "pipe",
+		},
+	}
+
+	resolver, err := NewResolver([]string{"10.0.0.0/8", "2001:db8::5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			if got := resolver.ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetwork(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "10.0.0.0/8", want: "10.0.0.0/8"},
+		{input: "10.1.2.3/8", want: "10.0.0.0/8"},
+		{input: "192.0.2.1", want: "192.0.2.1/32"},
+		{input: "2001:db8::1", want: "2001:db8::1/128"},
+		{input: "2001:db8::/32", want: "2001:db8::/32"},
+		{input: "example.com", wantErr: true},
+		{input: "10.0.0.0/33", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			network, err := ParseNetwork(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseNetwork(%q) = %v, want an error", tt.input, network)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseNetwork(%q): %v", tt.input, err)
+			}
+
+			if got := network.String(); got != tt.want {
+				t.Errorf("ParseNetwork(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func ReadString(qs url.Values, key string, defaultValue string) string {
@@ -40,3 +41,18 @@ func ReadInt(qs url.Values, key string, defaultValue int) int {
 
 	return l
 }
+
+func ReadTime(qs url.Values, key string, defaultValue time.Time) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return defaultValue
+	}
+
+	return t
+}
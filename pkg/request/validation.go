@@ -14,28 +14,43 @@ func ValidateInput(input interface{}) map[string]string {
 		errorMap := make(map[string]string)
 		for _, fieldError := range errs {
 			key := strings.ToLower(fieldError.Field())
-			switch {
-			case fieldError.Tag() == "required":
-				errorMap[key] = "must be provided"
-			case fieldError.Tag() == "unique":
-				errorMap[key] = "must not contain duplicate values"
-			case fieldError.Tag() == "gt":
-				errorMap[key] = fmt.Sprintf("must be greater than %s", fieldError.Param())
-			case fieldError.Tag() == "lt":
-				errorMap[key] = fmt.Sprintf("must be less than %s", fieldError.Param())
-			case fieldError.Tag() == "oneof":
-				errorMap[key] = fmt.Sprintf("must be one of %s", fieldError.Param())
-			case fieldError.Tag() == "max":
-				errorMap[key] = fmt.Sprintf("length must be not more then %s", fieldError.Param())
-			case fieldError.Tag() == "min":
-				errorMap[key] = fmt.Sprintf("length must be minimum %s long", fieldError.Param())
-			case fieldError.Tag() == "email":
-				errorMap[key] = "must be a valid email"
-			default:
-				errorMap[key] = fmt.Sprint(fieldError.Error())
-			}
+			errorMap[key] = ValidationMessage(fieldError)
 		}
 		return errorMap
 	}
 	return nil
 }
+
+// ValidationMessage returns the human readable message of a failed validation.
+func ValidationMessage(fieldError validator.FieldError) string {
+	switch {
+	case fieldError.Tag() == "required":
+		return "must be provided"
+	case fieldError.Tag() == "unique":
+		return "must not contain duplicate values"
+	case fieldError.Tag() == "gt":
+		return fmt.Sprintf("must be greater than %s", fieldError.Param())
+	case fieldError.Tag() == "gte":
+		return fmt.Sprintf("must be greater than or equal to %s", fieldError.Param())
+	case fieldError.Tag() == "lt":
+		return fmt.Sprintf("must be less than %s", fieldError.Param())
+	case fieldError.Tag() == "lte":
+		return fmt.Sprintf("must be less than or equal to %s", fieldError.Param())
+	case fieldError.Tag() == "oneof":
+		return fmt.Sprintf("must be one of %s", fieldError.Param())
+	case fieldError.Tag() == "max":
+		return fmt.Sprintf("length must be not more then %s", fieldError.Param())
+	case fieldError.Tag() == "min":
+		return fmt.Sprintf("length must be minimum %s long", fieldError.Param())
+	case fieldError.Tag() == "email":
+		return "must be a valid email"
+	case fieldError.Tag() == "url":
+		return "must be a valid URL"
+	case fieldError.Tag() == "startswith":
+		return fmt.Sprintf("must start with %s", fieldError.Param())
+	case fieldError.Tag() == "cidr|ip":
+		return "must be a valid CIDR or IP address"
+	default:
+		return fmt.Sprint(fieldError.Error())
+	}
+}
@@ -0,0 +1,76 @@
+// Package requestid identifies the requests, so the log lines and the
+// responses of a request can be correlated.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/sirupsen/logrus"
+)
+
+// Header is the header carrying the request ID in requests and responses.
+const Header = "X-Request-ID"
+
+// maxLength bounds the length of the IDs accepted from the clients.
+const maxLength = 128
+
+type contextKey struct{}
+
+// New returns a random request ID.
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether an ID received from a client can be propagated:
+// it has to be short and made of printable ASCII characters only, so it
+// cannot forge log lines or headers.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewContext returns a copy of ctx carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, if any.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// LogHook adds the request ID of the context of the log entries, set with
+// WithContext, to their fields.
+type LogHook struct{}
+
+func (LogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (LogHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	if id := FromContext(entry.Context); id != "" {
+		entry.Data["request_id"] = id
+	}
+
+	return nil
+}
@@ -1,32 +1,89 @@
 package response
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/lib/pq"
+	"github.com/nebisin/api_structure/pkg/realip"
+	"github.com/nebisin/api_structure/pkg/requestid"
 	"github.com/sirupsen/logrus"
 	"net/http"
 )
 
 // ErrorResponse is the default response function for errors. It takes http.ResponseWriter,
-// status code as an int and message interface.
+// status code as an int and message interface. The request ID set in the
+// response header, if any, is included so the error can be found in the logs.
 func ErrorResponse(w http.ResponseWriter, status int, message interface{}) {
-	err := JSONResponse(w, status, Envelope{"error": message})
+	env := Envelope{"error": message}
+	if id := w.Header().Get(requestid.Header); id != "" {
+		env["request_id"] = id
+	}
+
+	err := JSONResponse(w, status, env)
 	if err != nil {
 		w.WriteHeader(500)
 	}
 }
 
+// StatusClientClosedRequest is the non-standard status code recorded for the
+// requests which are canceled by the client before a response is sent.
+const StatusClientClosedRequest = 499
+
 // ServerErrorResponse function is for sending the 500 internal server error to the client.
 // ServerErrorResponse logs the request method, request url with the error message.
+// Errors caused by a canceled request or by an exceeded deadline are sent
+// with ClientClosedRequestResponse and TimeoutResponse instead, as are the
+// statements canceled by the database when their query timeout expired.
 func ServerErrorResponse(w http.ResponseWriter, r *http.Request, log *logrus.Logger, err error) {
-	log.WithFields(map[string]interface{}{
+	fields := log.WithContext(r.Context()).WithFields(map[string]interface{}{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
-	}).WithError(err).Error("server error response")
+		"client_ip":      realip.FromContext(r.Context()),
+	}).WithError(err)
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(r.Context().Err(), context.Canceled):
+		fields.Info("request canceled by the client")
+		ClientClosedRequestResponse(w, r)
+		return
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		fields.Warn("request timed out")
+		TimeoutResponse(w, r)
+		return
+	case isQueryCanceled(err):
+		fields.Warn("query canceled")
+		TimeoutResponse(w, r)
+		return
+	}
+
+	fields.Error("server error response")
 
 	message := "something went wrong"
 	ErrorResponse(w, http.StatusInternalServerError, message)
 }
 
+// queryCanceledCode is the SQLSTATE of the statements canceled by the
+// database, which lib/pq reports when the context of a query is done.
+const queryCanceledCode = "57014"
+
+// isQueryCanceled reports whether err is a statement canceled by the database.
+func isQueryCanceled(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == queryCanceledCode
+}
+
+// ClientClosedRequestResponse records that the client has gone away.
+// The client will never read the response, so no body is sent.
+func ClientClosedRequestResponse(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(StatusClientClosedRequest)
+}
+
+func TimeoutResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the server could not complete your request in time, please try again"
+	ErrorResponse(w, http.StatusServiceUnavailable, message)
+}
+
 func NotFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
 	ErrorResponse(w, http.StatusNotFound, message)
@@ -58,6 +115,11 @@ func RateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	ErrorResponse(w, http.StatusTooManyRequests, message)
 }
 
+func IPBlockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "access from your network is not allowed to this resource"
+	ErrorResponse(w, http.StatusForbidden, message)
+}
+
 func InvalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	ErrorResponse(w, http.StatusUnauthorized, message)
@@ -0,0 +1,44 @@
+package response
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "server error", err: errors.New("boom"), wantStatus: http.StatusInternalServerError},
+		{name: "canceled request", err: context.Canceled, wantStatus: StatusClientClosedRequest},
+		{name: "deadline exceeded", err: fmt.Errorf("query: %w", context.DeadlineExceeded), wantStatus: http.StatusServiceUnavailable},
+		{name: "canceled statement", err: &pq.Error{Code: "57014", Message: "canceling statement due to user request"}, wantStatus: http.StatusServiceUnavailable},
+		{name: "wrapped canceled statement", err: fmt.Errorf("query: %w", &pq.Error{Code: "57014"}), wantStatus: http.StatusServiceUnavailable},
+		{name: "other database error", err: &pq.Error{Code: "23505"}, wantStatus: http.StatusInternalServerError},
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			ServerErrorResponse(w, r, logger, tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
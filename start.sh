@@ -3,7 +3,7 @@
 set -e
 
 echo "run db migration"
-/app/migrate -path ./migrations -database "$DB_URI" -verbose up
+/app/main migrate up
 
 echo "start the app"
 exec "$@"
\ No newline at end of file